@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"backend/core/repositories"
+	"backend/core/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5"
+)
+
+func GetLockoutEvents(c fiber.Ctx) error {
+	limit, err := strconv.Atoi(c.Query("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Limit must be between 1 and 500",
+		})
+	}
+
+	rows, err := repositories.SelectLockoutEvents(limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch lockout events",
+		})
+	}
+	defer rows.Close()
+
+	events := []fiber.Map{}
+	for rows.Next() {
+		var id, failures int
+		var scope, subject, ipAddress string
+		var lockedUntil, createdAt time.Time
+
+		if err := rows.Scan(&id, &scope, &subject, &ipAddress, &failures, &lockedUntil, &createdAt); err != nil {
+			continue
+		}
+		events = append(events, fiber.Map{
+			"id":           id,
+			"scope":        scope,
+			"subject":      subject,
+			"ip_address":   ipAddress,
+			"failures":     failures,
+			"locked_until": lockedUntil,
+			"created_at":   createdAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"lockout_events": events,
+	})
+}
+
+func PutUserRole(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	targetID := c.Params("id")
+
+	if _, err := strconv.Atoi(targetID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if targetID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You can't change your own role",
+		})
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	exists, err := services.RoleExists(body.Role)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check role",
+		})
+	}
+	if !exists {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"role": "Unknown role",
+		})
+	}
+
+	updated, err := repositories.UpdateUserRole(targetID, body.Role)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update role",
+		})
+	}
+	if !updated {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":   targetID,
+		"role": body.Role,
+	})
+}
+
+// bans the user, their sessions and access tokens are revoked right away. Users who can ban
+// others can only be banned by those who manage roles
+func BanUser(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	role, _ := c.Locals("role").(string)
+	targetID := c.Params("id")
+
+	if _, err := strconv.Atoi(targetID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if targetID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You can't ban yourself",
+		})
+	}
+
+	if allowed, err := checkBanPermission(c, role, targetID, "ban"); !allowed {
+		return err
+	}
+
+	banned, err := repositories.BanUser(targetID)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to ban user",
+		})
+	}
+	if !banned {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already banned",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User banned",
+	})
+}
+
+func UnbanUser(c fiber.Ctx) error {
+	role, _ := c.Locals("role").(string)
+	targetID := c.Params("id")
+
+	if _, err := strconv.Atoi(targetID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if allowed, err := checkBanPermission(c, role, targetID, "unban"); !allowed {
+		return err
+	}
+
+	unbanned, err := repositories.UnbanUser(targetID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unban user",
+		})
+	}
+	if !unbanned {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not banned",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unbanned",
+	})
+}
+
+// users who can ban others themselves are banned and unbanned only by roles that manage roles,
+// allowed is false when a response was already sent
+func checkBanPermission(c fiber.Ctx, role string, targetID string, action string) (bool, error) {
+	targetRole, err := repositories.SelectUserRole(targetID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	targetCanBan, err := services.RoleHasPermission(targetRole, services.PermissionUsersBan)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check permissions",
+		})
+	}
+	if !targetCanBan {
+		return true, nil
+	}
+
+	canManageRoles, err := services.RoleHasPermission(role, services.PermissionUsersManageRoles)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check permissions",
+		})
+	}
+	if !canManageRoles {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can't " + action + " a " + targetRole,
+		})
+	}
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"backend/core/repositories"
+	"backend/core/services"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// the key itself is returned only in this response
+func CreateAPIKey(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	body := c.Locals("body").(struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	})
+
+	var expiresAt *time.Time
+	if body.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(body.Scopes)))
+
+	key, id, prefix, createdAt, err := services.CreateAPIKey(userID, body.Name, scopes, expiresAt)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":         id,
+		"name":       body.Name,
+		"key":        key,
+		"prefix":     prefix,
+		"scopes":     scopes,
+		"expires_at": expiresAt,
+		"created_at": createdAt,
+	})
+}
+
+func GetAPIKeys(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	rows, err := repositories.SelectAPIKeys(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch API keys",
+		})
+	}
+	defer rows.Close()
+
+	keys := []fiber.Map{}
+	for rows.Next() {
+		var id int
+		var name, prefix string
+		var scopes []string
+		var lastUsedAt, expiresAt *time.Time
+		var createdAt time.Time
+
+		if err := rows.Scan(&id, &name, &prefix, &scopes, &lastUsedAt, &expiresAt, &createdAt); err != nil {
+			continue
+		}
+		keys = append(keys, fiber.Map{
+			"id":           id,
+			"name":         name,
+			"prefix":       prefix,
+			"scopes":       scopes,
+			"last_used_at": lastUsedAt,
+			"expires_at":   expiresAt,
+			"created_at":   createdAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"api_keys": keys,
+	})
+}
+
+func DeleteAPIKey(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	keyID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid API key ID",
+		})
+	}
+
+	revoked, err := repositories.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke API key",
+		})
+	}
+
+	if !revoked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked",
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"backend/core/services"
+	"backend/main/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// clients opt in to cookie mode with this header on login, the refresh token is then kept in an
+// HttpOnly cookie instead of the response body
+const (
+	authModeHeader    = "X-Auth-Mode"
+	authModeCookie    = "cookie"
+	csrfHeader        = "X-CSRF-Token"
+	refreshCookie     = "refresh_token"
+	csrfCookie        = "csrf_token"
+	refreshCookiePath = "/auth/token"
+)
+
+func wantsCookieMode(c fiber.Ctx) bool {
+	return c.Get(authModeHeader) == authModeCookie
+}
+
+// sets the refresh cookie with a fresh double-submit CSRF token and returns the CSRF token.
+// The CSRF cookie is readable by scripts, cross-origin clients use the copy from the body
+func setAuthCookies(c fiber.Ctx, refreshToken string) string {
+	_, refreshExpiresIn := services.TokenExpiresIn()
+	csrfToken := rand.Text()
+
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshCookie,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		Domain:   config.AUTH_COOKIE_DOMAIN,
+		MaxAge:   refreshExpiresIn,
+		Secure:   config.AUTH_COOKIE_SECURE,
+		HTTPOnly: true,
+		SameSite: config.AUTH_COOKIE_SAMESITE,
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Domain:   config.AUTH_COOKIE_DOMAIN,
+		MaxAge:   refreshExpiresIn,
+		Secure:   config.AUTH_COOKIE_SECURE,
+		SameSite: config.AUTH_COOKIE_SAMESITE,
+	})
+
+	return csrfToken
+}
+
+func clearAuthCookies(c fiber.Ctx) {
+	for name, path := range map[string]string{refreshCookie: refreshCookiePath, csrfCookie: "/"} {
+		c.Cookie(&fiber.Cookie{
+			Name:     name,
+			Path:     path,
+			Domain:   config.AUTH_COOKIE_DOMAIN,
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			Secure:   config.AUTH_COOKIE_SECURE,
+			HTTPOnly: name == refreshCookie,
+			SameSite: config.AUTH_COOKIE_SAMESITE,
+		})
+	}
+}
+
+// the refresh token from the body, or from the cookie when the body has none. Cookie requests
+// must repeat the CSRF cookie in the X-CSRF-Token header, ok is false if they don't
+func refreshTokenFromRequest(c fiber.Ctx, bodyToken string) (token string, fromCookie bool, ok bool) {
+	if bodyToken != "" {
+		return bodyToken, false, true
+	}
+
+	token = c.Cookies(refreshCookie)
+	if token == "" {
+		return "", false, true
+	}
+
+	cookieCSRF := c.Cookies(csrfCookie)
+	headerCSRF := c.Get(csrfHeader)
+	if cookieCSRF == "" || subtle.ConstantTimeCompare([]byte(cookieCSRF), []byte(headerCSRF)) != 1 {
+		return "", true, false
+	}
+
+	return token, true, true
+}
+
+func invalidCSRFToken(c fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "Missing or invalid CSRF token",
+	})
+}
@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"backend/core/passwords"
 	"backend/core/repositories"
 	"backend/core/services"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
 )
 
 func Register(c fiber.Ctx) error {
@@ -40,34 +47,129 @@ func Login(c fiber.Ctx) error {
 	body := c.Locals("body").(struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Device   string `json:"device"`
 	})
 
+	attempt, retryAfter, err := services.Guard.BeginLogin(body.Email, c.IP())
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check login attempts",
+		})
+	}
+	if retryAfter > 0 {
+		return tooManyLoginAttempts(c, retryAfter)
+	}
+
 	user, username, err := services.LoginUser(body.Email, body.Password)
 	if err != nil {
+		if err := attempt.Fail(); err != nil {
+			log.Println(err)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Incorrect login or password",
 		})
 	}
 
-	accessToken := services.GenerateAccessToken(user.ID)
-	refreshToken := services.GenerateRefreshToken(user.ID)
+	if err := attempt.Succeed(); err != nil {
+		log.Println(err)
+	}
+
+	return completeLogin(c, user.ID, body.Email, username, body.Device)
+}
+
+// asks for the second factor when 2FA is enabled, otherwise starts the session right away
+func completeLogin(c fiber.Ctx, userID string, email string, fullName string, device string) error {
+	twoFactorEnabled, err := services.IsTwoFactorEnabled(userID)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check two-factor authentication",
+		})
+	}
+
+	if twoFactorEnabled {
+		challenge, err := services.GenerateTwoFactorChallenge(userID)
+		if err != nil {
+			log.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to issue two-factor challenge",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"two_factor_required": true,
+			"challenge":           challenge,
+		})
+	}
+
+	return startSession(c, userID, email, fullName, device)
+}
 
-	err = repositories.SaveAccessToken(user.ID, accessToken)
+// creates a session for the authenticated user and responds with its access/refresh pair
+func startSession(c fiber.Ctx, userID string, email string, fullName string, device string) error {
+	banned, err := repositories.IsUserBanned(userID)
 	if err != nil {
-		return nil
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check account status",
+		})
+	}
+	if banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is banned",
+		})
 	}
 
-	err = repositories.SaveRefreshToken(user.ID, refreshToken)
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	sessionID, err := repositories.CreateSession(userID, services.DeviceLabel(device, userAgent), userAgent, c.IP())
 	if err != nil {
-		return nil
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create session",
+		})
 	}
 
-	return c.JSON(fiber.Map{
-		"access":    accessToken,
-		"refresh":   refreshToken,
-		"id":        user.ID,
-		"email":     body.Email,
-		"full_name": username,
+	accessToken, err := services.GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to issue access token",
+		})
+	}
+	refreshToken, err := services.IssueRefreshToken(userID, sessionID)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save refresh token",
+		})
+	}
+
+	expiresIn, refreshExpiresIn := services.TokenExpiresIn()
+
+	response := fiber.Map{
+		"access":             accessToken,
+		"refresh":            refreshToken,
+		"expires_in":         expiresIn,
+		"refresh_expires_in": refreshExpiresIn,
+		"id":                 userID,
+		"email":              email,
+		"full_name":          fullName,
+	}
+
+	if wantsCookieMode(c) {
+		response["csrf_token"] = setAuthCookies(c, refreshToken)
+		delete(response, "refresh")
+	}
+
+	return c.JSON(response)
+}
+
+func tooManyLoginAttempts(c fiber.Ctx, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       "Too many failed login attempts, try again later",
+		"retry_after": seconds,
 	})
 }
 
@@ -90,26 +192,511 @@ func ValidateToken(c fiber.Ctx) error {
 	})
 }
 
+// rotates the refresh token from the body, or from the cookie in cookie mode
 func RefreshAccessToken(c fiber.Ctx) error {
 	var body struct {
 		Token string `json:"token"`
 	}
 
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid JSON",
+			})
+		}
+	}
+
+	token, fromCookie, ok := refreshTokenFromRequest(c, body.Token)
+	if !ok {
+		return invalidCSRFToken(c)
+	}
+
+	errCode, newAccessToken, newRefreshToken := services.GetNewAccessToken(token)
+
+	switch errCode {
+	case 1:
+		if fromCookie {
+			clearAuthCookies(c)
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid refresh token",
+		})
+	case 2:
+		if fromCookie {
+			clearAuthCookies(c)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Refresh token reuse detected, session has been revoked",
+		})
+	case 3:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to issue access token",
+		})
+	}
+
+	expiresIn, refreshExpiresIn := services.TokenExpiresIn()
+
+	response := fiber.Map{
+		"access":             newAccessToken,
+		"refresh":            newRefreshToken,
+		"expires_in":         expiresIn,
+		"refresh_expires_in": refreshExpiresIn,
+	}
+
+	if fromCookie {
+		response["csrf_token"] = setAuthCookies(c, newRefreshToken)
+		delete(response, "refresh")
+	}
+
+	return c.JSON(response)
+}
+
+// revokes the presented refresh token, in cookie mode it is taken from the cookie which is
+// only sent to /auth/token/revoke
+func Logout(c fiber.Ctx) error {
+	var body struct {
+		Token string `json:"token"`
+	}
+
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid JSON",
+			})
+		}
+	}
+
+	token, fromCookie, ok := refreshTokenFromRequest(c, body.Token)
+	if !ok {
+		return invalidCSRFToken(c)
+	}
+	if fromCookie {
+		clearAuthCookies(c)
+	}
+
+	revoked, err := repositories.RevokeRefreshToken(services.HashToken(token))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke refresh token",
+		})
+	}
+
+	if !revoked {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid refresh token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out",
+	})
+}
+
+// revokes every refresh token of the authorized user
+func LogoutAll(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := repositories.RevokeAllRefreshTokens(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke refresh tokens",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out from all sessions",
+	})
+}
+
+// lists the sessions where the authorized user is signed in
+func GetSessions(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	currentSessionID, _ := c.Locals("sessionID").(string)
+
+	rows, err := repositories.SelectActiveSessions(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch sessions",
+		})
+	}
+	defer rows.Close()
+
+	sessions := []fiber.Map{}
+	for rows.Next() {
+		var id, deviceLabel, userAgent, ipAddress string
+		var createdAt, lastUsedAt time.Time
+
+		if err := rows.Scan(&id, &deviceLabel, &userAgent, &ipAddress, &createdAt, &lastUsedAt); err != nil {
+			continue
+		}
+		sessions = append(sessions, fiber.Map{
+			"id":           id,
+			"device_label": deviceLabel,
+			"user_agent":   userAgent,
+			"ip_address":   ipAddress,
+			"created_at":   createdAt,
+			"last_used_at": lastUsedAt,
+			"current":      id == currentSessionID,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+	})
+}
+
+// ends a single session of the authorized user
+func DeleteSession(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	sessionID := c.Params("id")
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid session ID",
+		})
+	}
+
+	revoked, err := repositories.RevokeUserSession(userID, sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke session",
+		})
+	}
+
+	if !revoked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked",
+	})
+}
+
+func VerifyEmail(c fiber.Ctx) error {
+	var body struct {
+		Token string `json:"token"`
+	}
+
 	if err := json.Unmarshal(c.Body(), &body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid JSON",
 		})
 	}
 
-	errCode, newAccessToken := services.GetNewAccessToken(body.Token)
+	err := services.VerifyEmail(body.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOneTimeToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired verification token",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify email",
+		})
+	}
 
-	if errCode == 1 {
+	return c.JSON(fiber.Map{
+		"message": "Email verified",
+	})
+}
+
+func ResendVerification(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	err := services.ResendVerificationEmail(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailAlreadyVerified) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Email is already verified",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
+
+// always answers 202 so the response doesn't reveal whether the account exists
+func ForgotPassword(c fiber.Ctx) error {
+	body := c.Locals("body").(struct {
+		Email string `json:"email"`
+	})
+
+	// sent in the background so the response time doesn't leak it either
+	go func(email string) {
+		if err := services.RequestPasswordReset(email); err != nil {
+			log.Println(err)
+		}
+	}(body.Email)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If the account exists, a password reset email has been sent",
+	})
+}
+
+func ResetPassword(c fiber.Ctx) error {
+	body := c.Locals("body").(struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	})
+
+	err := services.ResetPassword(body.Token, body.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOneTimeToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired reset token",
+			})
+		}
+		var policyErr *passwords.PolicyError
+		if errors.As(err, &policyErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"password": policyErr.Message,
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password has been reset",
+	})
+}
+
+// applies an email change after the link sent to the new address was opened
+func ConfirmEmailChange(c fiber.Ctx) error {
+	var body struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid refresh token",
+			"error": "Invalid JSON",
+		})
+	}
+
+	err := services.ConfirmEmailChange(body.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOneTimeToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired confirmation token",
+			})
+		}
+		if errors.Is(err, services.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Email is already in use",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email changed",
+	})
+}
+
+// starts 2FA setup and returns the secret with an otpauth URI for authenticator apps
+func SetupTwoFactor(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	secret, uri, err := services.SetupTwoFactor(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Two-factor authentication is already enabled",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to set up two-factor authentication",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"access": newAccessToken,
+		"secret":      secret,
+		"otpauth_uri": uri,
 	})
 }
+
+func EnableTwoFactor(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	var body struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	recoveryCodes, err := services.EnableTwoFactor(userID, body.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Two-factor authentication is already enabled",
+			})
+		case errors.Is(err, services.ErrTwoFactorNotSetUp):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Two-factor authentication has not been set up",
+			})
+		case errors.Is(err, services.ErrInvalidTwoFactorCode):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"code": "Invalid code",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable two-factor authentication",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// second step of the login, exchanges the challenge and a totp or recovery code for tokens
+func VerifyTwoFactor(c fiber.Ctx) error {
+	var body struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		Device       string `json:"device"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	userID, challengeID, err := services.ParseTwoFactorChallenge(body.Challenge)
+	if err != nil {
+		return invalidTwoFactorChallenge(c, err)
+	}
+
+	attempt, retryAfter, err := services.Guard.BeginSecondFactor(userID, c.IP())
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check login attempts",
+		})
+	}
+	if retryAfter > 0 {
+		return tooManyLoginAttempts(c, retryAfter)
+	}
+
+	err = services.VerifySecondFactor(userID, body.Code, body.RecoveryCode)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) || errors.Is(err, services.ErrTwoFactorNotSetUp) {
+			if err := attempt.Fail(); err != nil {
+				log.Println(err)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid two-factor code",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify two-factor code",
+		})
+	}
+
+	if err := services.ConsumeTwoFactorChallenge(userID, challengeID); err != nil {
+		return invalidTwoFactorChallenge(c, err)
+	}
+
+	if err := attempt.Succeed(); err != nil {
+		log.Println(err)
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	return startSession(c, userID, user.Email, user.FullName, body.Device)
+}
+
+// 401 for challenges that are forged, expired or already used
+func invalidTwoFactorChallenge(c fiber.Ctx, err error) error {
+	if !errors.Is(err, services.ErrInvalidTwoFactorChallenge) {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check challenge",
+		})
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "Invalid or expired challenge",
+	})
+}
+
+// always answers 202, same as ForgotPassword
+func RequestMagicLink(c fiber.Ctx) error {
+	body := c.Locals("body").(struct {
+		Email string `json:"email"`
+	})
+
+	go func(email string) {
+		if err := services.RequestMagicLink(email); err != nil {
+			log.Println(err)
+		}
+	}(body.Email)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If the account exists, a sign-in link has been sent",
+	})
+}
+
+// exchanges a magic link token for the same response Login returns
+func ConsumeMagicLink(c fiber.Ctx) error {
+	var body struct {
+		Token  string `json:"token"`
+		Device string `json:"device"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	userID, err := services.ConsumeMagicLink(body.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidOneTimeToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired sign-in link",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign in",
+		})
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	return completeLogin(c, userID, user.Email, user.FullName, body.Device)
+}
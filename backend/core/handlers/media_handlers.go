@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"backend/core/storage"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// serves files of the local store by signed URL, the cache lifetime ends with the signature
+func ServeMedia(c fiber.Ctx) error {
+	store, ok := storage.Default.(*storage.LocalStore)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	expires := c.Query("expires")
+	path, err := store.Open(c.Params("*"), expires, c.Query("signature"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	unix, _ := strconv.ParseInt(expires, 10, 64)
+	maxAge := max(int(time.Until(time.Unix(unix, 0)).Seconds()), 0)
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(maxAge)+", immutable")
+
+	return c.SendFile(path)
+}
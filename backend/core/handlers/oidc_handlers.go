@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"backend/core/oidc"
+	"backend/core/repositories"
+	"backend/core/services"
+	"backend/main/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// HttpOnly cookie binding the login state to the browser that started it
+const (
+	oidcBrowserCookie     = "oidc_browser"
+	oidcBrowserCookiePath = "/auth/oidc"
+)
+
+func setOIDCBrowserCookie(c fiber.Ctx, browserKey string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcBrowserCookie,
+		Value:    browserKey,
+		Path:     oidcBrowserCookiePath,
+		Domain:   config.AUTH_COOKIE_DOMAIN,
+		MaxAge:   int(services.OIDCStateTTL / time.Second),
+		Secure:   config.AUTH_COOKIE_SECURE,
+		HTTPOnly: true,
+		SameSite: config.AUTH_COOKIE_SAMESITE,
+	})
+}
+
+func clearOIDCBrowserCookie(c fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcBrowserCookie,
+		Path:     oidcBrowserCookiePath,
+		Domain:   config.AUTH_COOKIE_DOMAIN,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		Secure:   config.AUTH_COOKIE_SECURE,
+		HTTPOnly: true,
+		SameSite: config.AUTH_COOKIE_SAMESITE,
+	})
+}
+
+func GetOIDCProviders(c fiber.Ctx) error {
+	names := oidc.ProviderNames()
+	sort.Strings(names)
+
+	return c.JSON(fiber.Map{
+		"providers": names,
+	})
+}
+
+// returns the url the client has to open to sign in with the provider
+func StartOIDCLogin(c fiber.Ctx) error {
+	authURL, browserKey, err := services.StartOIDCLogin(c.Context(), c.Params("provider"))
+	if err != nil {
+		if errors.Is(err, oidc.ErrUnknownProvider) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Unknown identity provider",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to start login with the identity provider",
+		})
+	}
+
+	setOIDCBrowserCookie(c, browserKey)
+
+	return c.JSON(fiber.Map{
+		"authorization_url": authURL,
+	})
+}
+
+// the client posts the code and state it received on the redirect url, from the browser
+// holding the cookie set when the login started
+func FinishOIDCLogin(c fiber.Ctx) error {
+	var body struct {
+		Code   string `json:"code"`
+		State  string `json:"state"`
+		Device string `json:"device"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	userID, err := services.FinishOIDCLogin(c.Context(), c.Params("provider"), body.Code, body.State, c.Cookies(oidcBrowserCookie))
+	if !errors.Is(err, services.ErrInvalidOIDCState) {
+		clearOIDCBrowserCookie(c)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrUnknownProvider):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Unknown identity provider",
+			})
+		case errors.Is(err, services.ErrInvalidOIDCState):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid or expired login state",
+			})
+		case errors.Is(err, services.ErrOIDCEmailMissing):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The identity provider didn't share an email address",
+			})
+		case errors.Is(err, services.ErrOIDCEmailNotVerified):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "An account with this email already exists, sign in with your password instead",
+			})
+		case errors.Is(err, services.ErrOIDCAccountNotVerified):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "An account with this email already exists but its email isn't verified, sign in with your password and verify your email first",
+			})
+		case errors.Is(err, services.ErrOIDCSignupNotVerified):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "The identity provider hasn't verified your email, verify it there or register with a password",
+			})
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			log.Println(err)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid identity token",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to sign in with the identity provider",
+		})
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	return completeLogin(c, userID, user.Email, user.FullName, body.Device)
+}
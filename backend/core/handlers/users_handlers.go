@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"backend/core/images"
 	"backend/core/repositories"
+	"backend/core/services"
 	"database/sql"
 	"errors"
 	"log"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/jackc/pgx/v5"
@@ -27,12 +30,103 @@ func GetUserInfo(c fiber.Ctx) error {
 		})
 	}
 
-	rows, err := repositories.SelectUserLanguages(userID)
+	languages, err := selectUserLanguages(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to query user languages",
+		})
+	}
+
+	avatarURL, avatarThumbURL := services.AvatarURLs(user)
+
+	return c.JSON(fiber.Map{
+		"id":                 user.ID,
+		"email":              user.Email,
+		"full_name":          user.FullName,
+		"verified":           user.Verified,
+		"profile_visibility": user.ProfileVisibility,
+		"bio":                user.Bio,
+		"country":            user.Country,
+		"timezone":           user.Timezone,
+		"birth_year":         user.BirthYear,
+		"pronouns":           user.Pronouns,
+		"interests":          user.Interests,
+		"avatar_url":         avatarURL,
+		"avatar_thumb_url":   avatarThumbURL,
+		"languages":          languages,
+	})
+}
+
+// applies a partial profile update and responds with the updated profile
+func PatchUserInfo(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	update := c.Locals("profile").(repositories.ProfileUpdate)
+
+	if err := repositories.UpdateProfile(userID, update); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update profile",
+		})
+	}
+
+	return GetUserInfo(c)
+}
+
+// profile of another user without private details, hidden users look like missing ones
+func GetUserProfile(c fiber.Ctx) error {
+	viewerID := c.Locals("userID").(string)
+	userID := c.Params("id")
+
+	canView, err := services.CanViewProfile(viewerID, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to query user",
+		})
+	}
+	if !canView {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to query user",
+		})
+	}
+
+	languages, err := selectUserLanguages(userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to query user languages",
 		})
 	}
+
+	avatarURL, avatarThumbURL := services.AvatarURLs(user)
+
+	return c.JSON(fiber.Map{
+		"id":               user.ID,
+		"full_name":        user.FullName,
+		"verified":         user.Verified,
+		"bio":              user.Bio,
+		"country":          user.Country,
+		"timezone":         user.Timezone,
+		"pronouns":         user.Pronouns,
+		"interests":        user.Interests,
+		"avatar_url":       avatarURL,
+		"avatar_thumb_url": avatarThumbURL,
+		"languages":        languages,
+	})
+}
+
+func selectUserLanguages(userID string) ([]map[string]interface{}, error) {
+	rows, err := repositories.SelectUserLanguages(userID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var languages []map[string]interface{}
@@ -40,22 +134,83 @@ func GetUserInfo(c fiber.Ctx) error {
 	for rows.Next() {
 		var languageID int
 		var langType string
-		if err := rows.Scan(&languageID, &langType); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to scan user language",
-			})
+		var level *string
+		if err := rows.Scan(&languageID, &langType, &level); err != nil {
+			return nil, err
 		}
 		languages = append(languages, map[string]interface{}{
 			"language_id": languageID,
 			"type":        langType,
+			"level":       level,
+		})
+	}
+
+	return languages, rows.Err()
+}
+
+func PutProfileVisibility(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	body := c.Locals("body").(struct {
+		Visibility string `json:"visibility"`
+	})
+
+	if err := repositories.UpdateProfileVisibility(userID, body.Visibility); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update profile visibility",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"id":        user.ID,
-		"email":     user.Email,
-		"full_name": user.FullName,
-		"languages": languages,
+		"profile_visibility": body.Visibility,
+	})
+}
+
+// hides both users from each other's profile
+func BlockUser(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	blockedID := c.Params("id")
+
+	if blockedID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You can't block yourself",
+		})
+	}
+
+	blocked, err := repositories.InsertUserBlock(userID, blockedID)
+	if err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to block user",
+		})
+	}
+	if !blocked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User blocked",
+	})
+}
+
+func UnblockUser(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	unblocked, err := repositories.DeleteUserBlock(userID, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unblock user",
+		})
+	}
+	if !unblocked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not blocked",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unblocked",
 	})
 }
 
@@ -63,8 +218,18 @@ func GetTargetedUsers(c fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	native := c.Query("native")
 	target := c.Query("target")
+	minLevel := c.Query("min_level")
+	maxLevel := c.Query("max_level")
 
-	rows, err := repositories.SelectTargetedUsers(target, native, userID)
+	for _, key := range []string{"min_level", "max_level"} {
+		if level := c.Query(key); level != "" && !repositories.IsCEFRLevel(level) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				key: "Level must be one of " + strings.Join(repositories.CEFRLevels, ", "),
+			})
+		}
+	}
+
+	rows, err := repositories.SelectTargetedUsers(target, native, minLevel, maxLevel, userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch users",
@@ -74,10 +239,10 @@ func GetTargetedUsers(c fiber.Ctx) error {
 
 	type userData struct {
 		ID       int
-		Email    string
 		FullName string
 		Natives  []int
 		Targets  []int
+		Levels   map[int]string
 	}
 
 	usersMap := make(map[int]*userData)
@@ -85,13 +250,13 @@ func GetTargetedUsers(c fiber.Ctx) error {
 	for rows.Next() {
 		var (
 			id       int
-			email    string
 			fullName string
 			langID   sql.NullInt32
 			langType sql.NullString
+			level    sql.NullString
 		)
 
-		if err := rows.Scan(&id, &email, &fullName, &langID, &langType); err != nil {
+		if err := rows.Scan(&id, &fullName, &langID, &langType, &level); err != nil {
 			continue
 		}
 
@@ -99,8 +264,8 @@ func GetTargetedUsers(c fiber.Ctx) error {
 		if !exists {
 			user = &userData{
 				ID:       id,
-				Email:    email,
 				FullName: fullName,
+				Levels:   make(map[int]string),
 			}
 			usersMap[id] = user
 		}
@@ -114,6 +279,9 @@ func GetTargetedUsers(c fiber.Ctx) error {
 			user.Natives = append(user.Natives, int(langID.Int32))
 		case "target":
 			user.Targets = append(user.Targets, int(langID.Int32))
+			if level.Valid {
+				user.Levels[int(langID.Int32)] = level.String
+			}
 		}
 	}
 
@@ -121,10 +289,10 @@ func GetTargetedUsers(c fiber.Ctx) error {
 	for _, u := range usersMap {
 		users = append(users, fiber.Map{
 			"id":        u.ID,
-			"email":     u.Email,
 			"full_name": u.FullName,
 			"native":    u.Natives,
 			"target":    u.Targets,
+			"levels":    u.Levels,
 		})
 	}
 
@@ -135,7 +303,12 @@ func UpdateUserLanguages(c fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	langs := c.Locals("languages").(repositories.Languages)
 
-	err := repositories.UpdateSelectedLanguages(userID, langs)
+	err := repositories.ReplaceUserLanguages(userID, langs)
+	if errors.Is(err, repositories.ErrUnknownLanguage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown language",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update users",
@@ -149,33 +322,133 @@ func UpdateUserLanguages(c fiber.Ctx) error {
 		})
 	}
 
-	rows, err := repositories.SelectUserLanguages(userID)
-
+	languages, err := selectUserLanguages(userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch user languages",
 		})
 	}
 
-	defer rows.Close()
+	return c.JSON(fiber.Map{
+		"id":        user.ID,
+		"email":     user.Email,
+		"full_name": user.FullName,
+		"languages": languages,
+	})
+}
 
-	var languages []fiber.Map
-	for rows.Next() {
-		var langID int
-		var langType string
-		if err := rows.Scan(&langID, &langType); err != nil {
-			continue
+func DeleteUserLanguage(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	deleted, err := repositories.DeleteUserLanguage(userID, c.Params("language_id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove language",
+		})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Language is not selected",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Language removed",
+	})
+}
+
+func ChangePassword(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	sessionID, _ := c.Locals("sessionID").(string)
+	body := c.Locals("body").(struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	})
+
+	err := services.ChangePassword(userID, sessionID, body.CurrentPassword, body.NewPassword)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPassword) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"current_password": "Current password is incorrect",
+			})
 		}
-		languages = append(languages, fiber.Map{
-			"language_id": langID,
-			"type":        langType,
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change password",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"id":        user.ID,
-		"email":     user.Email,
-		"full_name": user.FullName,
-		"languages": languages,
+		"message": "Password changed, other sessions have been signed out",
+	})
+}
+
+func ChangeEmail(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	body := c.Locals("body").(struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	})
+
+	err := services.RequestEmailChange(userID, body.Password, body.Email)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPassword) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"password": "Password is incorrect",
+			})
+		}
+		if errors.Is(err, services.ErrEmailTaken) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"email": "Email is already in use",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request email change",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Confirmation email sent to the new address",
+	})
+}
+
+func PutAvatar(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	data := c.Locals("avatar").([]byte)
+
+	err := services.UploadAvatar(c.Context(), userID, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, images.ErrUnsupportedFormat), errors.Is(err, images.ErrInvalidImage):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"avatar": "Avatar must be a valid JPEG, PNG or WebP image",
+			})
+		case errors.Is(err, images.ErrTooManyPixels):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"avatar": "Avatar dimensions are too large",
+			})
+		}
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save avatar",
+		})
+	}
+
+	return GetUserInfo(c)
+}
+
+func DeleteAvatar(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	if err := services.DeleteAvatar(c.Context(), userID); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete avatar",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Avatar deleted",
 	})
 }
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"backend/core/tokens"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// public keys other services use to validate access tokens offline
+func GetJWKS(c fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(tokens.Default.JWKS())
+}
@@ -0,0 +1,123 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"slices"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("image must be a JPEG, PNG or WebP")
+	ErrInvalidImage      = errors.New("image can't be decoded")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+)
+
+// formats accepted for uploads, detected from the content rather than the file name
+var AllowedContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// decoding bigger images would use too much memory
+const maxPixels = 40_000_000
+
+const thumbnailQuality = 85
+
+// sniffs the content type, "" if it isn't an allowed image format
+func DetectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(AllowedContentTypes, contentType) {
+		return ""
+	}
+	return contentType
+}
+
+// decodes the image and returns a square JPEG thumbnail for each size, cropped from the center.
+// The EXIF orientation of JPEGs is applied and re-encoding drops all metadata, including EXIF
+func Thumbnails(data []byte, sizes []int) (map[int][]byte, error) {
+	if DetectContentType(data) == "" {
+		return nil, ErrUnsupportedFormat
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	crop := centerSquare(src.Bounds())
+
+	thumbnails := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		// transparent areas become white since JPEG has no alpha
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, orient(dst, orientation), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+
+	return thumbnails, nil
+}
+
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// rotates or flips a square image by an EXIF orientation, the center crop looks the same
+// whether it is taken before or after, so only the small thumbnail has to be transformed
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	n := img.Bounds().Dx()
+	dst := image.NewRGBA(img.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = n-1-x, y
+			case 3: // rotated 180
+				dx, dy = n-1-x, n-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, n-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = n-1-y, x
+			case 7: // transversed
+				dx, dy = n-1-y, n-1-x
+			case 8: // rotated 90 counterclockwise
+				dx, dy = y, n-1-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,299 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{255, 0, 0, 255}
+	blue = color.RGBA{0, 0, 255, 255}
+)
+
+// width x height image, red in the top half and blue in the bottom half
+func halves(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if y < height/2 {
+				img.SetRGBA(x, y, red)
+			} else {
+				img.SetRGBA(x, y, blue)
+			}
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// APP1 segment with an EXIF orientation tag in the given byte order
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// inserts the segment right after the SOI marker
+func withSegment(jpegData []byte, segment []byte) []byte {
+	data := append([]byte{}, jpegData[:2]...)
+	data = append(data, segment...)
+	return append(data, jpegData[2:]...)
+}
+
+// markers of the segments before the image data
+func jpegMarkers(t *testing.T, data []byte) []byte {
+	t.Helper()
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		t.Fatal("not a JPEG")
+	}
+
+	var markers []byte
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			t.Fatalf("no marker at offset %d", i)
+		}
+		marker := data[i+1]
+		markers = append(markers, marker)
+		if marker == 0xDA {
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	return markers
+}
+
+// PNG claiming the given dimensions in its header, the pixel data is left as is
+func withPNGSize(t *testing.T, data []byte, width uint32, height uint32) []byte {
+	t.Helper()
+	patched := append([]byte{}, data...)
+	// signature (8), IHDR length (4) and type (4), then width and height
+	binary.BigEndian.PutUint32(patched[16:], width)
+	binary.BigEndian.PutUint32(patched[20:], height)
+	binary.BigEndian.PutUint32(patched[29:], crc32.ChecksumIEEE(patched[12:29]))
+	return patched
+}
+
+func isClose(c color.Color, want color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	diff := func(got uint32, want uint8) bool {
+		d := int(got>>8) - int(want)
+		return d > -48 && d < 48
+	}
+	return diff(r, want.R) && diff(g, want.G) && diff(b, want.B)
+}
+
+func TestDetectContentType(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, halves(4, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"jpeg", encodeJPEG(t, halves(4, 4)), "image/jpeg"},
+		{"png", encodePNG(t, halves(4, 4)), "image/png"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), "image/webp"},
+		{"gif", gifData.Bytes(), ""},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), ""},
+		{"html with an image extension", []byte("<html><script>alert(1)</script></html>"), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentType(tt.data); got != tt.want {
+				t.Fatalf("DetectContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailsRejectsInvalidInput(t *testing.T) {
+	valid := encodePNG(t, halves(8, 8))
+
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, halves(4, 4), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"gif", gifData.Bytes(), ErrUnsupportedFormat},
+		{"text", []byte("not an image"), ErrUnsupportedFormat},
+		{"truncated png", valid[:len(valid)/2], ErrInvalidImage},
+		{"too many pixels", withPNGSize(t, valid, 10_000, 10_000), ErrTooManyPixels},
+		{"one huge side", withPNGSize(t, valid, 1<<30, 1), ErrTooManyPixels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumbnails, err := Thumbnails(tt.data, []int{64})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Thumbnails() error = %v, want %v", err, tt.err)
+			}
+			if thumbnails != nil {
+				t.Fatal("Thumbnails() returned thumbnails with an error")
+			}
+		})
+	}
+}
+
+func TestThumbnailsDimensions(t *testing.T) {
+	for _, source := range []struct {
+		name string
+		data []byte
+	}{
+		{"landscape png", encodePNG(t, halves(300, 200))},
+		{"portrait jpeg", encodeJPEG(t, halves(120, 400))},
+		{"smaller than the thumbnail", encodePNG(t, halves(20, 30))},
+	} {
+		thumbnails, err := Thumbnails(source.data, []int{256, 64})
+		if err != nil {
+			t.Fatalf("%s: Thumbnails() error = %v", source.name, err)
+		}
+		if len(thumbnails) != 2 {
+			t.Fatalf("%s: got %d thumbnails, want 2", source.name, len(thumbnails))
+		}
+
+		for _, size := range []int{256, 64} {
+			config, format, err := image.DecodeConfig(bytes.NewReader(thumbnails[size]))
+			if err != nil {
+				t.Fatalf("%s: thumbnail %d can't be decoded: %v", source.name, size, err)
+			}
+			if format != "jpeg" || config.Width != size || config.Height != size {
+				t.Fatalf("%s: thumbnail %d is a %dx%d %s", source.name, size, config.Width, config.Height, format)
+			}
+		}
+	}
+}
+
+func TestThumbnailsAppliesOrientation(t *testing.T) {
+	source := encodeJPEG(t, halves(100, 100))
+
+	// where the red half of the source ends up once the orientation is applied
+	tests := []struct {
+		orientation uint16
+		order       binary.ByteOrder
+		redAt       image.Point
+		blueAt      image.Point
+	}{
+		{1, binary.BigEndian, image.Pt(32, 16), image.Pt(32, 48)},
+		{3, binary.LittleEndian, image.Pt(32, 48), image.Pt(32, 16)},
+		{6, binary.BigEndian, image.Pt(48, 32), image.Pt(16, 32)},
+		{6, binary.LittleEndian, image.Pt(48, 32), image.Pt(16, 32)},
+		{8, binary.LittleEndian, image.Pt(16, 32), image.Pt(48, 32)},
+	}
+
+	for _, tt := range tests {
+		data := withSegment(source, exifSegment(tt.order, tt.orientation))
+		if got := jpegOrientation(data); got != int(tt.orientation) {
+			t.Fatalf("jpegOrientation() = %d, want %d", got, tt.orientation)
+		}
+
+		thumbnails, err := Thumbnails(data, []int{64})
+		if err != nil {
+			t.Fatalf("orientation %d: Thumbnails() error = %v", tt.orientation, err)
+		}
+		thumbnail, err := jpeg.Decode(bytes.NewReader(thumbnails[64]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isClose(thumbnail.At(tt.redAt.X, tt.redAt.Y), red) || !isClose(thumbnail.At(tt.blueAt.X, tt.blueAt.Y), blue) {
+			t.Fatalf("orientation %d: got %v at %v and %v at %v, want red and blue", tt.orientation,
+				thumbnail.At(tt.redAt.X, tt.redAt.Y), tt.redAt, thumbnail.At(tt.blueAt.X, tt.blueAt.Y), tt.blueAt)
+		}
+	}
+}
+
+func TestJPEGOrientationMalformed(t *testing.T) {
+	source := encodeJPEG(t, halves(8, 8))
+	segment := exifSegment(binary.BigEndian, 6)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no exif", source},
+		{"not a jpeg", encodePNG(t, halves(8, 8))},
+		{"empty", nil},
+		{"out of range orientation", withSegment(source, exifSegment(binary.BigEndian, 9))},
+		{"segment length past the end", withSegment([]byte{0xFF, 0xD8}, segment[:len(segment)-4])},
+		{"unknown byte order", withSegment(source, bytes.Replace(segment, []byte("MM"), []byte("XX"), 1))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != 1 {
+				t.Fatalf("jpegOrientation() = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestThumbnailsStripMetadata(t *testing.T) {
+	source := withSegment(encodeJPEG(t, halves(50, 50)), exifSegment(binary.BigEndian, 6))
+	if markers := jpegMarkers(t, source); !bytes.Contains(markers, []byte{0xE1}) {
+		t.Fatal("the source has no APP1 segment")
+	}
+
+	thumbnails, err := Thumbnails(source, []int{256, 64})
+	if err != nil {
+		t.Fatalf("Thumbnails() error = %v", err)
+	}
+
+	for size, thumbnail := range thumbnails {
+		if markers := jpegMarkers(t, thumbnail); bytes.Contains(markers, []byte{0xE1}) {
+			t.Fatalf("thumbnail %d has an APP1 segment", size)
+		}
+		if bytes.Contains(thumbnail, []byte("Exif\x00\x00")) {
+			t.Fatalf("thumbnail %d contains EXIF data", size)
+		}
+	}
+}
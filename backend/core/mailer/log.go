@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// stand-in for local development, writes emails to a file or to the log instead of sending them
+type LogMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(to string, subject string, body string) error {
+	entry := fmt.Sprintf("[%s] To: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+
+	if m.Path == "" {
+		log.Print("Email not sent (log mailer):\n" + entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log %s: %w", m.Path, err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(entry)
+	return err
+}
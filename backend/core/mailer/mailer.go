@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"backend/main/config"
+	"log"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+var Default Mailer
+
+// selects the mailer implementation according to the config
+func InitMailer() {
+	switch config.MAILER {
+	case "smtp":
+		Default = &SMTPMailer{
+			Host:     config.SMTP_HOST,
+			Port:     config.SMTP_PORT,
+			Username: config.SMTP_USERNAME,
+			Password: config.SMTP_PASSWORD,
+			From:     config.MAIL_FROM,
+		}
+	case "log":
+		Default = &LogMailer{Path: config.MAIL_LOG_PATH}
+	default:
+		log.Fatalf("Unknown MAILER %q, expected smtp or log", config.MAILER)
+	}
+}
+
+func Send(to string, subject string, body string) error {
+	return Default.Send(to, subject, body)
+}
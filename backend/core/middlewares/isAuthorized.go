@@ -2,12 +2,16 @@ package middlewares
 
 import (
 	"backend/core/services"
+	"backend/core/tokens"
+	"errors"
+	"slices"
 	"strings"
 
 	"github.com/gofiber/fiber/v3"
 )
 
-// used to check whether the user is authorized
+// used to check whether the user is authorized, accepts access tokens and,
+// on routes marked with RequireScope, API keys
 func IsAuthorized(c fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 
@@ -17,6 +21,10 @@ func IsAuthorized(c fiber.Ctx) error {
 		})
 	}
 
+	if strings.HasPrefix(authHeader, "ApiKey ") {
+		return authorizeAPIKey(c, strings.TrimPrefix(authHeader, "ApiKey "))
+	}
+
 	if !strings.HasPrefix(authHeader, "Bearer ") {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Authorization header is invalid",
@@ -24,16 +32,79 @@ func IsAuthorized(c fiber.Ctx) error {
 	}
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
-	isTokenValid := services.ValidateToken(token)
 
-	userID, err := services.ExtractID(token)
-	if err != nil || !isTokenValid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid or expired token",
+	claims, err := services.ParseAccessToken(token)
+	if err != nil {
+		return unauthorizedToken(c, err)
+	}
+
+	c.Locals("userID", claims.Subject)
+	c.Locals("sessionID", claims.SessionID)
+	c.Locals("tokenID", claims.ID)
+	c.Locals("role", claims.Role)
+	c.Locals("authMethod", "jwt")
+
+	return c.Next()
+}
+
+// API keys work only on routes that declared the scope they need
+func authorizeAPIKey(c fiber.Ctx, key string) error {
+	requiredScope, _ := c.Locals("requiredScope").(string)
+	if requiredScope == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys can't be used for this endpoint",
+		})
+	}
+
+	userID, role, scopes, err := services.AuthenticateAPIKey(key)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid or expired API key",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check API key",
+		})
+	}
+
+	if !slices.Contains(scopes, requiredScope) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API key lacks the " + requiredScope + " scope",
 		})
 	}
 
 	c.Locals("userID", userID)
+	c.Locals("role", role)
+	c.Locals("authMethod", "api_key")
 
 	return c.Next()
 }
+
+// tells the client why the token was rejected, so it knows whether refreshing can help
+func unauthorizedToken(c fiber.Ctx, err error) error {
+	message, code := "Invalid token", "invalid_token"
+
+	switch {
+	case errors.Is(err, tokens.ErrExpired):
+		message, code = "Token expired", "token_expired"
+	case errors.Is(err, tokens.ErrMalformed):
+		message, code = "Malformed token", "malformed_token"
+	case errors.Is(err, tokens.ErrBadSignature),
+		errors.Is(err, tokens.ErrUnknownKey),
+		errors.Is(err, tokens.ErrUnsupportedAlgorithm):
+		message, code = "Invalid token signature", "invalid_signature"
+	case errors.Is(err, tokens.ErrNotYetValid):
+		message, code = "Token is not valid yet", "token_not_yet_valid"
+	case errors.Is(err, tokens.ErrInvalidIssuer), errors.Is(err, tokens.ErrInvalidAudience):
+		message, code = "Token was not issued for this service", "invalid_claims"
+	case errors.Is(err, services.ErrAccessTokenRevoked):
+		message, code = "Token has been revoked", "token_revoked"
+	}
+
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token", error_description="`+message+`"`)
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": message,
+		"code":  code,
+	})
+}
@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"backend/core/repositories"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// used after IsAuthorized to allow only users with a verified email
+func IsVerified(c fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	verified, err := repositories.IsUserVerified(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check email verification",
+		})
+	}
+
+	if !verified {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Email address is not verified",
+		})
+	}
+
+	return c.Next()
+}
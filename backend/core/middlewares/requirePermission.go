@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"backend/core/services"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// used after IsAuthorized to allow only roles having all of the permissions
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+
+		for _, permission := range permissions {
+			granted, err := services.RoleHasPermission(role, permission)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to check permissions",
+				})
+			}
+
+			if !granted {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "You don't have permission to perform this action",
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
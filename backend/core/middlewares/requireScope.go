@@ -0,0 +1,12 @@
+package middlewares
+
+import "github.com/gofiber/fiber/v3"
+
+// marks the route as reachable with API keys that have the scope, must come before IsAuthorized.
+// Access tokens aren't restricted by scopes
+func RequireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		c.Locals("requiredScope", scope)
+		return c.Next()
+	}
+}
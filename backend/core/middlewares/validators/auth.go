@@ -1,6 +1,7 @@
 package validators
 
 import (
+	"backend/core/passwords"
 	"encoding/json"
 	"regexp"
 
@@ -26,15 +27,15 @@ func ValidateRegisterInfo(c fiber.Ctx) error {
 		})
 	}
 
-	if len(body.Password) < 6 {
+	if !isValidEmail(body.Email) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"password": "Password must be at least 6 characters long",
+			"email": "Invalid email format",
 		})
 	}
 
-	if !isValidEmail(body.Email) {
+	if err := passwords.Default.Check(body.Password, body.Email, body.Username); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"email": "Invalid email format",
+			"password": err.Error(),
 		})
 	}
 
@@ -47,6 +48,7 @@ func ValidateLoginInfo(c fiber.Ctx) error {
 	var body struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Device   string `json:"device"`
 	}
 	if err := json.Unmarshal(c.Body(), &body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -54,9 +56,10 @@ func ValidateLoginInfo(c fiber.Ctx) error {
 		})
 	}
 
-	if len(body.Password) <= 6 {
+	// the policy only applies to new passwords, older ones may not satisfy it
+	if body.Password == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"password": "Password must be at least 6 characters long",
+			"password": "Password is required",
 		})
 	}
 
@@ -75,3 +78,54 @@ func isValidEmail(email string) bool {
 	re := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 	return re.MatchString(email)
 }
+
+// validates bodies consisting of a single email, e.g. password reset or magic link requests
+func ValidateEmailInfo(c fiber.Ctx) error {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	if !isValidEmail(body.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"email": "Invalid email format",
+		})
+	}
+
+	c.Locals("body", body)
+
+	return c.Next()
+}
+
+func ValidateResetPasswordInfo(c fiber.Ctx) error {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON",
+		})
+	}
+
+	if body.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"token": "Token is required",
+		})
+	}
+
+	// the policy is checked by the service, it needs the email and name of the token owner
+	if body.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"password": "Password is required",
+		})
+	}
+
+	c.Locals("body", body)
+
+	return c.Next()
+}
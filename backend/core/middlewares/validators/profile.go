@@ -0,0 +1,231 @@
+package validators
+
+import (
+	"backend/core/images"
+	"backend/core/repositories"
+	"backend/main/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	maxBioLength       = 500
+	maxPronounsLength  = 32
+	maxInterests       = 10
+	maxInterestLength  = 32
+	maxAvatarURLLength = 2048
+	minimumAge         = 13
+	maximumAge         = 120
+)
+
+// ISO 3166-1 alpha-2 codes of officially assigned countries
+var countryCodes = strings.Fields("AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW")
+
+// validates a partial profile update: missing fields are left alone, null clears a field.
+// Every invalid field is reported under its own key
+func ValidateProfileUpdate(c fiber.Ctx) error {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format",
+		})
+	}
+
+	update := repositories.ProfileUpdate{}
+	errs := fiber.Map{}
+
+	for field, raw := range body {
+		value, message := validateProfileField(field, raw)
+		if message != "" {
+			errs[field] = message
+			continue
+		}
+		update[field] = value
+	}
+
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errs)
+	}
+	if len(update) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No fields to update",
+		})
+	}
+
+	c.Locals("profile", update)
+	return c.Next()
+}
+
+// returns the value to store or a message describing why the field is invalid
+func validateProfileField(field string, raw json.RawMessage) (any, string) {
+	isNull := string(raw) == "null"
+
+	switch field {
+	case "full_name":
+		var name string
+		if json.Unmarshal(raw, &name) != nil || utf8.RuneCountInString(strings.TrimSpace(name)) < 6 {
+			return nil, "Username must be at least 6 characters long"
+		}
+		return strings.TrimSpace(name), ""
+
+	case "bio", "pronouns":
+		if isNull {
+			return nil, ""
+		}
+		limit := maxBioLength
+		if field == "pronouns" {
+			limit = maxPronounsLength
+		}
+		var text string
+		if json.Unmarshal(raw, &text) != nil || utf8.RuneCountInString(text) > limit {
+			return nil, fmt.Sprintf("Must be a string of at most %d characters", limit)
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return nil, ""
+		}
+		return text, ""
+
+	case "country":
+		if isNull {
+			return nil, ""
+		}
+		var country string
+		if json.Unmarshal(raw, &country) != nil || !isCountryCode(strings.ToUpper(country)) {
+			return nil, "Must be an ISO 3166-1 alpha-2 country code"
+		}
+		return strings.ToUpper(country), ""
+
+	case "timezone":
+		if isNull {
+			return nil, ""
+		}
+		var timezone string
+		if json.Unmarshal(raw, &timezone) != nil || !isTimezone(timezone) {
+			return nil, "Must be an IANA time zone like Europe/Berlin"
+		}
+		return timezone, ""
+
+	case "birth_year":
+		if isNull {
+			return nil, ""
+		}
+		var year int
+		currentYear := time.Now().Year()
+		if json.Unmarshal(raw, &year) != nil || year < currentYear-maximumAge || year > currentYear-minimumAge {
+			return nil, fmt.Sprintf("Must be a year between %d and %d", currentYear-maximumAge, currentYear-minimumAge)
+		}
+		return year, ""
+
+	case "interests":
+		var interests []string
+		if !isNull && json.Unmarshal(raw, &interests) != nil {
+			return nil, "Must be a list of strings"
+		}
+		return normalizeInterests(interests)
+
+	case "avatar_url":
+		if isNull {
+			return nil, ""
+		}
+		var avatarURL string
+		if json.Unmarshal(raw, &avatarURL) != nil || !isAvatarURL(avatarURL) {
+			return nil, "Must be an https URL"
+		}
+		return avatarURL, ""
+
+	default:
+		return nil, "Unknown field"
+	}
+}
+
+func isCountryCode(code string) bool {
+	return slices.Contains(countryCodes, code)
+}
+
+// names known to the tz database, "Local" depends on the server so it is rejected
+func isTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func isAvatarURL(raw string) bool {
+	if len(raw) > maxAvatarURLLength {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	return err == nil && parsed.Scheme == "https" && parsed.Host != ""
+}
+
+// trims and deduplicates interests case-insensitively, null clears them
+func normalizeInterests(interests []string) (any, string) {
+	normalized := []string{}
+	seen := map[string]bool{}
+
+	for _, interest := range interests {
+		interest = strings.TrimSpace(interest)
+		if interest == "" || seen[strings.ToLower(interest)] {
+			continue
+		}
+		if utf8.RuneCountInString(interest) > maxInterestLength {
+			return nil, fmt.Sprintf("Each interest must be at most %d characters", maxInterestLength)
+		}
+		seen[strings.ToLower(interest)] = true
+		normalized = append(normalized, interest)
+	}
+
+	if len(normalized) > maxInterests {
+		return nil, fmt.Sprintf("At most %d interests are allowed", maxInterests)
+	}
+	return normalized, ""
+}
+
+// reads the "avatar" multipart file, checking its size and sniffing its content type
+func ValidateAvatarUpload(c fiber.Ctx) error {
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"avatar": "Avatar file is required",
+		})
+	}
+
+	if header.Size > int64(config.AVATAR_MAX_BYTES) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"avatar": fmt.Sprintf("Avatar must be at most %d bytes", config.AVATAR_MAX_BYTES),
+		})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"avatar": "Failed to read avatar file",
+		})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(config.AVATAR_MAX_BYTES)+1))
+	if err != nil || len(data) > config.AVATAR_MAX_BYTES {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"avatar": "Failed to read avatar file",
+		})
+	}
+
+	if images.DetectContentType(data) == "" {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"avatar": "Avatar must be a JPEG, PNG or WebP image",
+		})
+	}
+
+	c.Locals("avatar", data)
+	return c.Next()
+}
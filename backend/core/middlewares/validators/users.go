@@ -1,8 +1,13 @@
 package validators
 
 import (
+	"backend/core/passwords"
 	"backend/core/repositories"
+	"backend/core/services"
+	"backend/main/config"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -16,12 +21,177 @@ func ValidateLanguages(c fiber.Ctx) error {
 		})
 	}
 
-	if len(body.Native) == 0 && len(body.Target) == 0 {
+	if len(body.Native) > config.MAX_NATIVE_LANGUAGES {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "At least one of 'native' or 'target' must be provided",
+			"native": fmt.Sprintf("At most %d native languages are allowed", config.MAX_NATIVE_LANGUAGES),
+		})
+	}
+	if len(body.Target) > config.MAX_TARGET_LANGUAGES {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"target": fmt.Sprintf("At most %d target languages are allowed", config.MAX_TARGET_LANGUAGES),
 		})
 	}
 
+	types := make(map[int]string)
+	for _, key := range []string{"native", "target"} {
+		langs := body.Native
+		if key == "target" {
+			langs = body.Target
+		}
+		for _, lang := range langs {
+			if lang.LanguageID <= 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					key: "Language ids must be positive",
+				})
+			}
+			if seen, ok := types[lang.LanguageID]; ok {
+				message := fmt.Sprintf("Language %d is listed more than once", lang.LanguageID)
+				if seen != key {
+					message = fmt.Sprintf("Language %d can't be both native and target", lang.LanguageID)
+				}
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					key: message,
+				})
+			}
+			types[lang.LanguageID] = key
+		}
+	}
+
+	for _, lang := range body.Native {
+		if lang.Level != "" && lang.Level != repositories.LevelNative {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"native": "Native languages can only have the level " + repositories.LevelNative,
+			})
+		}
+	}
+	for _, lang := range body.Target {
+		if lang.Level != "" && !repositories.IsCEFRLevel(lang.Level) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"target": "Level must be one of " + strings.Join(repositories.CEFRLevels, ", "),
+			})
+		}
+	}
+
 	c.Locals("languages", body)
 	return c.Next()
 }
+
+func ValidateChangePasswordInfo(c fiber.Ctx) error {
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format",
+		})
+	}
+
+	if body.CurrentPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"current_password": "Current password is required",
+		})
+	}
+
+	if err := passwords.Default.Check(body.NewPassword, body.CurrentPassword); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"new_password": err.Error(),
+		})
+	}
+
+	c.Locals("body", body)
+	return c.Next()
+}
+
+func ValidateChangeEmailInfo(c fiber.Ctx) error {
+	var body struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format",
+		})
+	}
+
+	if body.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"password": "Password is required",
+		})
+	}
+
+	if !isValidEmail(body.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"email": "Invalid email format",
+		})
+	}
+
+	c.Locals("body", body)
+	return c.Next()
+}
+
+func ValidateCreateAPIKey(c fiber.Ctx) error {
+	var body struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format",
+		})
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 64 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"name": "Name must be between 1 and 64 characters long",
+		})
+	}
+
+	if len(body.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"scopes": "At least one scope must be provided",
+		})
+	}
+	for _, scope := range body.Scopes {
+		if !services.IsValidAPIKeyScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"scopes": "Unknown scope " + scope + ", allowed: " + strings.Join(services.APIKeyScopes, ", "),
+			})
+		}
+	}
+
+	if body.ExpiresInDays < 0 || body.ExpiresInDays > 365 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"expires_in_days": "Expiration must be between 1 and 365 days, or 0 for a key that doesn't expire",
+		})
+	}
+
+	c.Locals("body", body)
+	return c.Next()
+}
+
+func ValidateProfileVisibility(c fiber.Ctx) error {
+	var body struct {
+		Visibility string `json:"visibility"`
+	}
+
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid JSON format",
+		})
+	}
+
+	if !services.IsValidProfileVisibility(body.Visibility) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"visibility": "Visibility must be one of " + strings.Join(services.ProfileVisibilities, ", "),
+		})
+	}
+
+	c.Locals("body", body)
+	return c.Next()
+}
@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"backend/core/tokens"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const idTokenLeeway = time.Minute
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+type IDTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      tokens.Audience `json:"aud"`
+	AuthorizedBy  string          `json:"azp"`
+	ExpiresAt     int64           `json:"exp"`
+	IssuedAt      int64           `json:"iat"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified flexibleBool    `json:"email_verified"`
+	Name          string          `json:"name"`
+}
+
+// some providers (Apple) send booleans as strings
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// verifies the signature against the provider's keys and validates the claims (OIDC Core 3.1.3.7)
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken string, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidIDToken)
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidIDToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidIDToken)
+	}
+
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	key, err := keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+	if !verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidIDToken)
+	}
+	var claims IDTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidIDToken)
+	}
+
+	if err := claims.validate(discovery.Issuer, p.ClientID, nonce, time.Now()); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (c *IDTokenClaims) validate(issuer string, clientID string, nonce string, now time.Time) error {
+	if c.Issuer != issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, c.Issuer)
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if !slices.Contains(c.Audience, clientID) {
+		return fmt.Errorf("%w: audience", ErrInvalidIDToken)
+	}
+	if len(c.Audience) > 1 && c.AuthorizedBy != clientID {
+		return fmt.Errorf("%w: authorized party", ErrInvalidIDToken)
+	}
+
+	leeway := int64(idTokenLeeway / time.Second)
+	if now.Unix() > c.ExpiresAt+leeway {
+		return fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if c.IssuedAt > now.Unix()+leeway {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Nonce), []byte(nonce)) != 1 {
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// the algorithm has to match the key type so a key can't be used with a weaker algorithm
+func verifySignature(alg string, key crypto.PublicKey, data []byte, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(public, digest[:], r, s)
+	case "EdDSA":
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+		return ed25519.Verify(public, data, signature)
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+// Package oidctest runs a minimal OpenID Connect provider on an httptest server, it serves
+// discovery, JWKS and the token endpoint so the whole code flow can be exercised locally
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const KeyID = "test-key"
+
+type grant struct {
+	claims        map[string]any
+	codeChallenge string
+	redirectURI   string
+}
+
+type IdP struct {
+	Server   *httptest.Server
+	ClientID string
+
+	// ID tokens are signed with Signer under KeyID while the JWKS publishes Published,
+	// replacing Signer makes the signatures invalid
+	Signer    *rsa.PrivateKey
+	Published *rsa.PublicKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// starts the provider, it is closed when the test ends
+func New(t testing.TB, clientID string) *IdP {
+	t.Helper()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &IdP{
+		ClientID:  clientID,
+		Signer:    key,
+		Published: &key.PublicKey,
+		codes:     make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /jwks", idp.jwks)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Server.Close)
+
+	return idp
+}
+
+func GenerateKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+func (i *IdP) Issuer() string {
+	return i.Server.URL
+}
+
+// plays the user signing in on the login page of authURL and returns the code and state the
+// client gets on its redirect url. Claims are added to the ID token and override the defaults
+// (iss, aud, exp, iat and the nonce of the request)
+func (i *IdP) Authorize(authURL string, claims map[string]any) (string, string, error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+
+	if query.Get("client_id") != i.ClientID || query.Get("response_type") != "code" {
+		return "", "", errors.New("invalid authorization request")
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", errors.New("PKCE is required")
+	}
+
+	now := time.Now().Unix()
+	idClaims := map[string]any{
+		"iss":   i.Issuer(),
+		"aud":   i.ClientID,
+		"exp":   now + 300,
+		"iat":   now,
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idClaims[name] = value
+	}
+
+	code := rand.Text()
+	i.mu.Lock()
+	i.codes[code] = grant{claims: idClaims, codeChallenge: query.Get("code_challenge"), redirectURI: query.Get("redirect_uri")}
+	i.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+func (i *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.Issuer(),
+		"authorization_endpoint": i.Issuer() + "/authorize",
+		"token_endpoint":         i.Issuer() + "/token",
+		"jwks_uri":               i.Issuer() + "/jwks",
+	})
+}
+
+func (i *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kid": KeyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(i.Published.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.Published.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *IdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	g, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("client_id") != i.ClientID || r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := i.sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (i *IdP) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": KeyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.Signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
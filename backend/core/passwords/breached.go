@@ -0,0 +1,115 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// length of the hash prefix sent to a BreachedList, as in the Pwned Passwords range API
+const rangePrefixLength = 5
+
+// source of breached password hashes queried by k-anonymity: only the first five hex chars
+// of the SHA-1 are given and the suffixes of every hash with that prefix are returned
+type BreachedList interface {
+	Range(prefix string) ([]string, error)
+}
+
+func IsBreached(list BreachedList, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := list.Range(hash[:rangePrefixLength])
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(suffixes, hash[rangePrefixLength:]), nil
+}
+
+// breached list kept in a local file with one uppercase SHA-1 per line sorted by hash,
+// optionally followed by ":<count>" like the downloadable Pwned Passwords list.
+// Only the offsets of each prefix are kept in memory
+type FileBreachedList struct {
+	path    string
+	offsets map[string][2]int64 // prefix -> start and end offset
+}
+
+func LoadFileBreachedList(path string) (*FileBreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &FileBreachedList{path: path, offsets: make(map[string][2]int64)}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	var lastPrefix string
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+
+		if hash := strings.TrimSpace(line); hash != "" {
+			if len(hash) < sha1.Size*2 {
+				return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, lineNumber)
+			}
+			prefix := strings.ToUpper(hash[:rangePrefixLength])
+			if prefix < lastPrefix {
+				return nil, fmt.Errorf("%s:%d: hashes are not sorted", path, lineNumber)
+			}
+
+			bounds, ok := list.offsets[prefix]
+			if !ok {
+				bounds[0] = offset
+			}
+			bounds[1] = offset + int64(len(line))
+			list.offsets[prefix] = bounds
+			lastPrefix = prefix
+		}
+
+		offset += int64(len(line))
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return list, nil
+}
+
+func (l *FileBreachedList) Range(prefix string) ([]string, error) {
+	bounds, ok := l.offsets[strings.ToUpper(prefix)]
+	if !ok {
+		return nil, nil
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	section := make([]byte, bounds[1]-bounds[0])
+	if _, err := file.ReadAt(section, bounds[0]); err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	for _, line := range strings.Split(string(section), "\n") {
+		hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+		if len(hash) > rangePrefixLength {
+			suffixes = append(suffixes, strings.ToUpper(hash[rangePrefixLength:]))
+		}
+	}
+	return suffixes, nil
+}
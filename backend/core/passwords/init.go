@@ -0,0 +1,49 @@
+package passwords
+
+import (
+	"backend/main/config"
+	"log"
+)
+
+// selects the algorithm and parameters of new password hashes from the PASSWORD_HASH_* settings
+func InitHasher() {
+	DefaultHasher = &Hasher{
+		Algorithm:  config.PASSWORD_HASH_ALGORITHM,
+		BcryptCost: config.PASSWORD_BCRYPT_COST,
+		Argon2: Argon2Params{
+			Memory:     uint32(config.PASSWORD_ARGON2_MEMORY),
+			Time:       uint32(config.PASSWORD_ARGON2_TIME),
+			Threads:    uint8(config.PASSWORD_ARGON2_THREADS),
+			SaltLength: 16,
+			KeyLength:  32,
+		},
+	}
+
+	if _, err := DefaultHasher.Hash(""); err != nil {
+		log.Fatalf("Invalid password hash settings: %v", err)
+	}
+}
+
+// builds the default policy from the PASSWORD_* settings
+func InitPolicy() {
+	Default = &Policy{
+		MinLength:     config.PASSWORD_MIN_LENGTH,
+		MaxLength:     config.PASSWORD_MAX_LENGTH,
+		RequireLower:  config.PASSWORD_REQUIRE_LOWER,
+		RequireUpper:  config.PASSWORD_REQUIRE_UPPER,
+		RequireDigit:  config.PASSWORD_REQUIRE_DIGIT,
+		RequireSymbol: config.PASSWORD_REQUIRE_SYMBOL,
+		MinStrength:   config.PASSWORD_MIN_STRENGTH,
+	}
+
+	if config.PASSWORD_BREACHED_LIST == "" {
+		return
+	}
+
+	list, err := LoadFileBreachedList(config.PASSWORD_BREACHED_LIST)
+	if err != nil {
+		log.Fatalf("Failed to load breached password list: %v", err)
+	}
+	log.Printf("Loaded breached password list with %d prefixes", len(list.offsets))
+	Default.Breached = list
+}
@@ -0,0 +1,91 @@
+package passwords
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// returned by Check, the message is meant to be shown next to the password field
+type PolicyError struct {
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// rules a new password has to satisfy
+type Policy struct {
+	MinLength     int
+	MaxLength     int // in bytes, bcrypt ignores anything after 72
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	MinStrength   int // minimal Strength score, 0 to 4
+
+	Breached BreachedList // nil disables the breached password check
+}
+
+var Default *Policy
+
+// validates a new password. userInputs like the email or name make the password weaker
+// when it contains them. Failing to read the breached list is logged and doesn't reject
+func (p *Policy) Check(password string, userInputs ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &PolicyError{fmt.Sprintf("Password must be at least %d characters long", p.MinLength)}
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return &PolicyError{fmt.Sprintf("Password must be at most %d bytes long", p.MaxLength)}
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	var missing []string
+	if p.RequireLower && !hasLower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.RequireUpper && !hasUpper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		missing = append(missing, "a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return &PolicyError{"Password must contain " + strings.Join(missing, ", ")}
+	}
+
+	if Strength(password, userInputs...) < p.MinStrength {
+		return &PolicyError{"Password is too easy to guess, avoid repeats, sequences and personal details"}
+	}
+
+	if p.Breached != nil {
+		breached, err := IsBreached(p.Breached, password)
+		if err != nil {
+			log.Printf("Failed to check breached passwords: %v", err)
+		} else if breached {
+			return &PolicyError{"Password has appeared in a data breach, choose a different one"}
+		}
+	}
+
+	return nil
+}
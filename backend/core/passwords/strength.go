@@ -0,0 +1,216 @@
+package passwords
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// entropy in bits needed for the scores 1 to 4
+var strengthThresholds = [4]float64{28, 36, 60, 80}
+
+// the most common passwords ordered by frequency, taken from zxcvbn (MIT license)
+//
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var commonPasswords = sync.OnceValue(func() map[string]int {
+	words := strings.Fields(commonPasswordsList)
+	ranks := make(map[string]int, len(words))
+	for i, word := range words {
+		ranks[word] = i + 1
+	}
+	return ranks
+})
+
+// shortest common password matched inside a longer password
+const minCommonPasswordLength = 4
+
+// keyboard rows with and without shift, neighbouring keys are next to each other in a row
+// or in the row above or below
+var (
+	keyboardRows        = []string{"1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./"}
+	shiftedKeyboardRows = []string{"!@#$%^&*()_+", "qwertyuiop{}", "asdfghjkl:\"", "zxcvbnm<>?"}
+)
+
+var leetReplacements = map[rune]rune{'@': 'a', '4': 'a', '3': 'e', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't'}
+
+// estimates how hard the password is to guess on a 0 to 4 scale. Common passwords (also with
+// leetspeak or reversed), parts of the user inputs, repeats, sequences and keyboard walks add
+// almost nothing
+func Strength(password string, userInputs ...string) int {
+	bits := entropy(password, userInputs)
+
+	score := 0
+	for _, threshold := range strengthThresholds {
+		if bits >= threshold {
+			score++
+		}
+	}
+	return score
+}
+
+func entropy(password string, userInputs []string) float64 {
+	runes := []rune(strings.ToLower(password))
+	unleeted := make([]rune, len(runes))
+	for i, r := range runes {
+		if replacement, ok := leetReplacements[r]; ok {
+			r = replacement
+		}
+		unleeted[i] = r
+	}
+
+	inputs := make(map[string]bool)
+	for _, input := range userInputs {
+		for _, part := range inputParts(input) {
+			inputs[part] = true
+		}
+	}
+
+	perChar := math.Log2(float64(charsetSize(password)))
+
+	bits := 0.0
+	for i := 0; i < len(runes); {
+		if length, cost := wordMatch(runes, unleeted, i, inputs); length > 0 {
+			bits += cost
+			i += length
+			continue
+		}
+
+		bits += min(perChar, patternCost(runes, i))
+		i++
+	}
+	return bits
+}
+
+// the longest common password or user input starting at i and the bits it costs,
+// a word is guessed at once so its cost depends only on its rank
+func wordMatch(runes []rune, unleeted []rune, i int, inputs map[string]bool) (int, float64) {
+	ranks := commonPasswords()
+
+	// user input parts are at least 3 characters long
+	for j := len(runes); j-i >= 3; j-- {
+		for _, candidate := range [][]rune{runes[i:j], unleeted[i:j]} {
+			word := string(candidate)
+			if inputs[word] {
+				return j - i, 4
+			}
+			if j-i < minCommonPasswordLength {
+				continue
+			}
+			if rank, ok := ranks[word]; ok {
+				return j - i, math.Log2(float64(rank)) + 1
+			}
+			if rank, ok := ranks[reverse(candidate)]; ok {
+				return j - i, math.Log2(float64(rank)) + 2
+			}
+		}
+	}
+	return 0, 0
+}
+
+// bits of a character continuing a pattern with the previous ones, infinite when there is none
+func patternCost(runes []rune, i int) float64 {
+	if i == 0 {
+		return math.Inf(1)
+	}
+
+	diff := runes[i] - runes[i-1]
+	// repeats and steps of one ("aaaa", "abcd", "4321")
+	if diff >= -1 && diff <= 1 {
+		return 1
+	}
+	// sequences with a larger step ("2468", "acegi")
+	if i >= 2 && diff == runes[i-1]-runes[i-2] {
+		return 1
+	}
+	if keyboardNeighbours(runes[i-1], runes[i]) {
+		return 2
+	}
+	return math.Inf(1)
+}
+
+func keyboardNeighbours(a rune, b rune) bool {
+	rowA, colA := keyPosition(a)
+	rowB, colB := keyPosition(b)
+	if rowA < 0 || rowB < 0 {
+		return false
+	}
+
+	rows, cols := rowA-rowB, colA-colB
+	return rows >= -1 && rows <= 1 && cols >= -1 && cols <= 1
+}
+
+func keyPosition(r rune) (int, int) {
+	for row := range keyboardRows {
+		if col := strings.IndexRune(keyboardRows[row], r); col >= 0 {
+			return row, col
+		}
+		if col := strings.IndexRune(shiftedKeyboardRows[row], r); col >= 0 {
+			return row, col
+		}
+	}
+	return -1, -1
+}
+
+func reverse(runes []rune) string {
+	reversed := make([]rune, len(runes))
+	for i, r := range runes {
+		reversed[len(runes)-1-i] = r
+	}
+	return string(reversed)
+}
+
+// the number of characters an attacker has to try per position
+func charsetSize(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r <= unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return max(size, 2)
+}
+
+// words of an email or a name that are long enough to matter
+func inputParts(input string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var parts []string
+	for _, field := range fields {
+		if len(field) >= 3 {
+			parts = append(parts, field)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,32 @@
+package passwords
+
+import "testing"
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+		min        int
+		max        int
+	}{
+		{"password1", nil, 0, 0},
+		{"Password1!", nil, 0, 0},
+		{"p@ssw0rd", nil, 0, 0},
+		{"drowssap", nil, 0, 0},
+		{"qwertyuiop", nil, 0, 0},
+		{"1qaz2wsx", nil, 0, 0},
+		{"!@#$%^&*", nil, 0, 0},
+		{"2468101214", nil, 0, 0},
+		{"iloveyou2024", nil, 0, 1},
+		{"maria.lopez1990", []string{"maria.lopez@example.com", "Maria Lopez"}, 0, 1},
+		{"kT9#mQ2!vX", nil, 2, 4},
+		{"Tr0ub4dor&3", nil, 2, 4},
+		{"correct horse battery staple", nil, 3, 4},
+	}
+
+	for _, tt := range tests {
+		if got := Strength(tt.password, tt.userInputs...); got < tt.min || got > tt.max {
+			t.Errorf("Strength(%q) = %d, want between %d and %d", tt.password, got, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// channel notified with "<jti> <expires unix>" for every revoked access token
+const AccessTokensRevokedChannel = "access_tokens_revoked"
+
+// appended to a query whose revoked_access CTE returns the revoked jti and expires_at
+const notifyRevokedAccessTokens = `
+	SELECT pg_notify('` + AccessTokensRevokedChannel + `', jti || ' ' || floor(extract(epoch FROM expires_at))::bigint)
+	FROM revoked_access`
+
+func SaveAccessToken(userID string, sessionID string, jti string, expiresAt time.Time) error {
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO access_tokens (user_id, session_id, jti, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		userID, sessionID, jti, expiresAt)
+
+	return err
+}
+
+// access tokens that were revoked and haven't expired yet
+func SelectRevokedAccessTokens() (pgx.Rows, error) {
+	rows, err := db.DB.Query(context.Background(), `
+		SELECT jti, expires_at FROM access_tokens
+		WHERE revoked_at IS NOT NULL AND expires_at > NOW()
+	`)
+
+	return rows, err
+}
+
+// listens on the channel with a dedicated connection, onListen is called once LISTEN is active
+// so nothing revoked after it is missed. Blocks until the connection fails or ctx is done
+func ListenAccessTokenRevocations(ctx context.Context, onListen func() error, onRevoke func(payload string)) error {
+	conn, err := db.DB.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+AccessTokensRevokedChannel); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "UNLISTEN "+AccessTokensRevokedChannel)
+
+	if err := onListen(); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onRevoke(notification.Payload)
+	}
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func InsertAPIKey(userID string, name string, prefix string, keyHash string, scopes []string, expiresAt *time.Time) (int, time.Time, error) {
+	var id int
+	var createdAt time.Time
+	err := db.DB.QueryRow(context.Background(), `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, userID, name, prefix, keyHash, scopes, expiresAt).Scan(&id, &createdAt)
+
+	return id, createdAt, err
+}
+
+func SelectAPIKeys(userID string) (pgx.Rows, error) {
+	rows, err := db.DB.Query(context.Background(), `
+		SELECT id, name, prefix, scopes, last_used_at, expires_at, created_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+
+	return rows, err
+}
+
+// looks up a usable key and records its use, returns the owner, their role and the key scopes.
+// pgx.ErrNoRows is returned for unknown, expired or revoked keys
+func UseAPIKey(keyHash string) (string, string, []string, error) {
+	var userID, role string
+	var scopes []string
+	err := db.DB.QueryRow(context.Background(), `
+		UPDATE api_keys k
+		SET last_used_at = NOW()
+		FROM users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW())
+			AND u.id = k.user_id AND u.banned_at IS NULL
+		RETURNING k.user_id, u.role, k.scopes
+	`, keyHash).Scan(&userID, &role, &scopes)
+
+	return userID, role, scopes, err
+}
+
+func RevokeAPIKey(userID string, keyID int) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -3,7 +3,15 @@ package repositories
 import (
 	"backend/core/db"
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been rotated")
 )
 
 type User struct {
@@ -11,36 +19,27 @@ type User struct {
 	Password string
 }
 
-func CreateUser(username string, password string, email string) error {
-	_, err := db.DB.Exec(context.Background(), `
+func CreateUser(username string, password string, email string) (string, error) {
+	var userID string
+	err := db.DB.QueryRow(context.Background(), `
         INSERT INTO users (full_name, password_hash, email) 
         VALUES ($1, $2, $3) 
         RETURNING id`,
 		username, password, email,
-	)
+	).Scan(&userID)
 
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+	return userID, nil
 }
 
-func SaveAccessToken(uuid string, accessToken string) error {
+// refresh tokens are stored as SHA-256 digests, the raw values are never persisted
+func SaveRefreshToken(uuid string, refreshTokenHash string, sessionID string, expiresAt time.Time) error {
 	_, err := db.DB.Exec(context.Background(), `
-		INSERT INTO access_tokens (user_id, token, expires_at, created_at) 
-		VALUES ($1, $2, $3, $4)`,
-		uuid, accessToken, time.Now().Add(15*time.Minute), time.Now())
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func SaveRefreshToken(uuid string, refreshToken string) error {
-	_, err := db.DB.Exec(context.Background(), `
-		INSERT INTO refresh_tokens (user_id, token, expires_at, created_at, revoked) 
-		VALUES ($1, $2, $3, $4, false)`,
-		uuid, refreshToken, time.Now().Add(24*time.Hour), time.Now())
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, revoked) 
+		VALUES ($1, $2, $3, $4, $5, false)`,
+		uuid, refreshTokenHash, sessionID, expiresAt, time.Now())
 	if err != nil {
 		return err
 	}
@@ -63,3 +62,214 @@ func LoginUser(email string) (string, string, string, error) {
 	}
 	return userID, userPassword, username, nil
 }
+
+// revokes the session the presented refresh token belongs to
+func RevokeRefreshToken(refreshTokenHash string) (bool, error) {
+	var sessionID string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT family_id FROM refresh_tokens
+		WHERE token_hash = $1 AND revoked = false
+	`, refreshTokenHash).Scan(&sessionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	err = revokeSession(context.Background(), db.DB, sessionID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revokes every session of the user with its refresh and access tokens
+func RevokeAllRefreshTokens(userID string) error {
+	return revokeUserSessions(context.Background(), db.DB, userID)
+}
+
+func SelectRefreshTokenOwner(refreshTokenHash string) (string, error) {
+	var userID string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT user_id FROM refresh_tokens WHERE token_hash = $1
+	`, refreshTokenHash).Scan(&userID)
+
+	return userID, err
+}
+
+// replaces the old refresh token with the new one inside the same family and
+// returns the session id. Presenting a token that was already rotated revokes the whole family
+func RotateRefreshToken(oldTokenHash string, newTokenHash string, expiresAt time.Time) (string, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		id        int
+		userID    string
+		familyID  string
+		revoked   bool
+		rotatedAt *time.Time
+		expTime   time.Time
+	)
+
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, family_id, revoked, rotated_at, expires_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, oldTokenHash).Scan(&id, &userID, &familyID, &revoked, &rotatedAt, &expTime)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrRefreshTokenInvalid
+		}
+		return "", err
+	}
+
+	if rotatedAt != nil {
+		if err := revokeSession(ctx, tx, familyID); err != nil {
+			return "", err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return "", err
+		}
+		return "", ErrRefreshTokenReused
+	}
+
+	if revoked || time.Now().After(expTime) {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked = true, rotated_at = $1
+		WHERE id = $2
+	`, time.Now(), id)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at, revoked)
+		VALUES ($1, $2, $3, $4, $5, false)`,
+		userID, newTokenHash, familyID, expiresAt, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions SET last_used_at = $1 WHERE id = $2
+	`, time.Now(), familyID)
+	if err != nil {
+		return "", err
+	}
+
+	return familyID, tx.Commit(ctx)
+}
+
+func SelectUserIDByEmail(email string) (string, error) {
+	var userID string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT id FROM users WHERE email = $1
+	`, email).Scan(&userID)
+
+	return userID, err
+}
+
+func UpdatePasswordHash(userID string, passwordHash string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE users
+		SET password_hash = $1, updated_at = NOW()
+		WHERE id = $2`,
+		passwordHash, userID)
+
+	return err
+}
+
+// consumes the reset token, sets the new hash, invalidates the other reset and magic links
+// and signs the user out everywhere. pgx.ErrNoRows is returned if the token was used meanwhile
+func ResetPassword(tokenHash string, userID string, passwordHash string) error {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var owner string
+	err = tx.QueryRow(ctx, `
+		UPDATE one_time_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, tokenHash, PurposePasswordReset).Scan(&owner)
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return pgx.ErrNoRows
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE users
+		SET password_hash = $1, updated_at = NOW()
+		WHERE id = $2`,
+		passwordHash, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE one_time_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = ANY($2) AND used_at IS NULL`,
+		userID, []string{PurposePasswordReset, PurposeMagicLink}); err != nil {
+		return err
+	}
+
+	if err := revokeUserSessions(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// replaces the hash only if it is still the one that was read, so it can't overwrite
+// a password changed in the meantime. Returns false when the hash was changed
+func ReplacePasswordHash(userID string, oldPasswordHash string, newPasswordHash string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE users
+		SET password_hash = $1, updated_at = NOW()
+		WHERE id = $2 AND password_hash = $3`,
+		newPasswordHash, userID, oldPasswordHash)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func SelectPasswordHash(userID string) (string, error) {
+	var passwordHash string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT password_hash FROM users WHERE id = $1
+	`, userID).Scan(&passwordHash)
+
+	return passwordHash, err
+}
+
+// replaces the email, the new address counts as verified since the change was confirmed through it
+func UpdateEmail(userID string, email string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE users
+		SET email = $1, verified_at = NOW(), updated_at = NOW()
+		WHERE id = $2`,
+		email, userID)
+
+	return err
+}
@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+)
+
+func SaveOIDCState(state string, provider string, browserHash string, nonce string, codeVerifier string, expiresAt time.Time) error {
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO oidc_states (state, provider, browser_hash, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		state, provider, browserHash, nonce, codeVerifier, expiresAt)
+
+	return err
+}
+
+// deletes the state and returns its nonce and PKCE verifier, pgx.ErrNoRows is returned
+// for unknown, expired or already used states and states started by another browser
+func ConsumeOIDCState(state string, provider string, browserHash string) (string, string, error) {
+	var nonce, codeVerifier string
+	err := db.DB.QueryRow(context.Background(), `
+		DELETE FROM oidc_states
+		WHERE state = $1 AND provider = $2 AND browser_hash = $3 AND expires_at > NOW()
+		RETURNING nonce, code_verifier
+	`, state, provider, browserHash).Scan(&nonce, &codeVerifier)
+
+	return nonce, codeVerifier, err
+}
+
+func SelectUserIDByIdentity(provider string, subject string) (string, error) {
+	var userID string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT user_id FROM identities WHERE provider = $1 AND subject = $2
+	`, provider, subject).Scan(&userID)
+
+	return userID, err
+}
+
+func InsertIdentity(userID string, provider string, subject string, email string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)`,
+		userID, provider, subject, email)
+
+	return err
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+)
+
+// deletes expired refresh tokens and revoked ones that were not rotated. Rotated tokens are
+// kept until they expire so reuse of them can still be detected
+func DeleteStaleRefreshTokens() (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM refresh_tokens
+		WHERE expires_at < NOW() OR (revoked = true AND rotated_at IS NULL)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// deletes sessions left without refresh tokens, the grace period covers sessions being created
+func DeleteStaleSessions(gracePeriod time.Duration) (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM sessions s
+		WHERE s.created_at < NOW() - make_interval(secs => $1) AND NOT EXISTS (
+			SELECT 1 FROM refresh_tokens rt WHERE rt.family_id = s.id
+		)
+	`, gracePeriod.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func DeleteExpiredAccessTokens() (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM access_tokens WHERE expires_at < NOW()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func DeleteStaleOneTimeTokens() (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM one_time_tokens WHERE expires_at < NOW() OR used_at IS NOT NULL
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func DeleteExpiredOIDCStates() (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM oidc_states WHERE expires_at < NOW()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func DeleteStaleTwoFactorChallenges() (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM two_factor_challenges WHERE expires_at < NOW() OR used_at IS NOT NULL
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// deletes failure counters that are no longer blocking and would be reset on the next failure anyway
+func DeleteStaleLoginAttempts(resetAfter time.Duration) (int64, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < NOW() - make_interval(secs => $1)
+			AND (blocked_until IS NULL OR blocked_until < NOW())
+	`, resetAfter.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
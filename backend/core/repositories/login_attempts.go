@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// returns the failures and the block of a key, zero values if there were no failures
+func SelectLoginAttempt(key string) (int, time.Time, time.Time, error) {
+	var failures int
+	var lastFailureAt time.Time
+	var blockedUntil *time.Time
+
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT failures, last_failure_at, blocked_until FROM login_attempts WHERE key = $1
+	`, key).Scan(&failures, &lastFailureAt, &blockedUntil)
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, err
+	}
+
+	if blockedUntil == nil {
+		return failures, lastFailureAt, time.Time{}, nil
+	}
+	return failures, lastFailureAt, *blockedUntil, nil
+}
+
+// counts an attempt unless the key is blocked, pgx.ErrNoRows when it is. The counter starts over
+// when the previous attempt is older than resetAfter and stays at maxFailures after an expired block
+func IncrementLoginFailures(key string, resetAfter time.Duration, maxFailures int) (int, error) {
+	var failures int
+	err := db.DB.QueryRow(context.Background(), `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				WHEN login_attempts.blocked_until IS NOT NULL THEN LEAST(login_attempts.failures + 1, $3)
+				ELSE login_attempts.failures + 1
+			END,
+			blocked_until = NULL,
+			last_failure_at = NOW()
+		WHERE login_attempts.blocked_until IS NULL OR login_attempts.blocked_until <= NOW()
+		RETURNING failures
+	`, key, resetAfter.Seconds(), maxFailures).Scan(&failures)
+
+	return failures, err
+}
+
+// extends the block of a key, a shorter block never replaces a longer one
+func BlockLoginAttempts(key string, blockedUntil time.Time) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE login_attempts SET blocked_until = GREATEST(blocked_until, $1) WHERE key = $2
+	`, blockedUntil, key)
+
+	return err
+}
+
+func RefundLoginFailure(key string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE key = $1
+	`, key)
+
+	return err
+}
+
+func DeleteLoginAttempts(key string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		DELETE FROM login_attempts WHERE key = $1
+	`, key)
+
+	return err
+}
+
+func InsertLockoutEvent(scope string, subject string, ipAddress string, failures int, lockedUntil time.Time) error {
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO lockout_events (scope, subject, ip_address, failures, locked_until)
+		VALUES ($1, $2, $3, $4, $5)`,
+		scope, subject, ipAddress, failures, lockedUntil)
+
+	return err
+}
+
+func SelectLockoutEvents(limit int) (pgx.Rows, error) {
+	rows, err := db.DB.Query(context.Background(), `
+		SELECT id, scope, subject, ip_address, failures, locked_until, created_at
+		FROM lockout_events
+		ORDER BY created_at DESC
+		LIMIT $1
+	`, limit)
+
+	return rows, err
+}
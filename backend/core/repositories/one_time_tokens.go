@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+)
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailChange       = "email_change"
+	PurposeMagicLink         = "magic_link"
+)
+
+func SaveOneTimeToken(userID string, purpose string, tokenHash string, email string, expiresAt time.Time) error {
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO one_time_tokens (user_id, purpose, token_hash, email, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		userID, purpose, tokenHash, email, expiresAt)
+
+	return err
+}
+
+// returns the owner and email of an unused token without consuming it, pgx.ErrNoRows is
+// returned if the token doesn't exist, is expired or was already used
+func SelectOneTimeToken(purpose string, tokenHash string) (string, string, error) {
+	var userID, email string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT user_id, email FROM one_time_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+	`, tokenHash, purpose).Scan(&userID, &email)
+
+	return userID, email, err
+}
+
+// marks the token as used and returns its owner and email, pgx.ErrNoRows is returned
+// if the token doesn't exist, is expired or was already used
+func ConsumeOneTimeToken(purpose string, tokenHash string) (string, string, error) {
+	var userID, email string
+	err := db.DB.QueryRow(context.Background(), `
+		UPDATE one_time_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email
+	`, tokenHash, purpose).Scan(&userID, &email)
+
+	return userID, email, err
+}
+
+// invalidates every unused token of the user with the given purpose
+func InvalidateOneTimeTokens(userID string, purpose string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE one_time_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purpose)
+
+	return err
+}
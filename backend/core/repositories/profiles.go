@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+)
+
+// what decides whether the viewer may see the profile of the user
+type ProfileAccess struct {
+	Visibility string
+	Banned     bool
+	Blocked    bool // either of them blocked the other
+	Matched    bool // they have an accepted match request
+}
+
+func SelectProfileAccess(viewerID string, userID string) (ProfileAccess, error) {
+	var access ProfileAccess
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT
+			u.profile_visibility,
+			u.banned_at IS NOT NULL,
+			EXISTS (
+				SELECT 1 FROM user_blocks
+				WHERE (blocker_id = $1 AND blocked_id = u.id) OR (blocker_id = u.id AND blocked_id = $1)
+			),
+			EXISTS (
+				SELECT 1 FROM match_requests
+				WHERE status = 'accepted'
+					AND ((from_user_id = $1 AND to_user_id = u.id) OR (from_user_id = u.id AND to_user_id = $1))
+			)
+		FROM users u
+		WHERE u.id = $2
+	`, viewerID, userID).Scan(&access.Visibility, &access.Banned, &access.Blocked, &access.Matched)
+
+	return access, err
+}
+
+func UpdateProfileVisibility(userID string, visibility string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE users SET profile_visibility = $1, updated_at = NOW() WHERE id = $2
+	`, visibility, userID)
+
+	return err
+}
+
+// blocking twice is a no-op, false if the user doesn't exist
+func InsertUserBlock(blockerID string, blockedID string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		SELECT $1, id FROM users WHERE id = $2
+		ON CONFLICT (blocker_id, blocked_id) DO UPDATE SET created_at = user_blocks.created_at
+	`, blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func DeleteUserBlock(blockerID string, blockedID string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`, blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// every role with its permissions, roles without permissions have a NULL permission
+func SelectRolePermissions() (pgx.Rows, error) {
+	rows, err := db.DB.Query(context.Background(), `
+		SELECT r.name, rp.permission
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+	`)
+
+	return rows, err
+}
+
+func SelectUserRole(userID string) (string, error) {
+	var role string
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT role FROM users WHERE id = $1
+	`, userID).Scan(&role)
+
+	return role, err
+}
+
+// changes the role and revokes all sessions and access tokens of the user, so no token
+// keeps the old role claim until it expires
+func UpdateUserRole(userID string, role string) (bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var previous string
+	err = tx.QueryRow(ctx, `
+		SELECT role FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if previous == role {
+		return true, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2
+	`, role, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if err := revokeUserSessions(ctx, tx, userID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func IsUserBanned(userID string) (bool, error) {
+	var banned bool
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT banned_at IS NOT NULL FROM users WHERE id = $1
+	`, userID).Scan(&banned)
+
+	return banned, err
+}
+
+// bans the user and revokes all of their sessions and tokens, API keys stop working while
+// the ban lasts. false if the user is missing or already banned
+func BanUser(userID string) (bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET banned_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND banned_at IS NULL
+	`, userID)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+
+	if err := revokeUserSessions(ctx, tx, userID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func UnbanUser(userID string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE users SET banned_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND banned_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// common interface of the pool and transactions
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func CreateSession(userID string, deviceLabel string, userAgent string, ipAddress string) (string, error) {
+	var sessionID string
+	err := db.DB.QueryRow(context.Background(), `
+		INSERT INTO sessions (user_id, device_label, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, deviceLabel, userAgent, ipAddress).Scan(&sessionID)
+
+	return sessionID, err
+}
+
+// returns sessions that still have a usable refresh token
+func SelectActiveSessions(userID string) (pgx.Rows, error) {
+	rows, err := db.DB.Query(context.Background(), `
+		SELECT s.id, s.device_label, s.user_agent, s.ip_address, s.created_at, s.last_used_at
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.revoked = false AND EXISTS (
+			SELECT 1 FROM refresh_tokens rt
+			WHERE rt.family_id = s.id AND rt.revoked = false AND rt.expires_at > NOW()
+		)
+		ORDER BY s.last_used_at DESC
+	`, userID)
+
+	return rows, err
+}
+
+// revokes a session of the given user, false is returned if there is no such active session
+func RevokeUserSession(userID string, sessionID string) (bool, error) {
+	var exists bool
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND revoked = false)
+	`, sessionID, userID).Scan(&exists)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if err := revokeSession(context.Background(), db.DB, sessionID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revokes the session with its refresh tokens and access tokens issued for it
+func revokeSession(ctx context.Context, q execer, sessionID string) error {
+	_, err := q.Exec(ctx, `
+		WITH revoked_session AS (
+			UPDATE sessions SET revoked = true WHERE id = $1
+		), revoked_refresh AS (
+			UPDATE refresh_tokens
+			SET revoked = true
+			WHERE family_id = $1 AND revoked = false
+		), revoked_access AS (
+			UPDATE access_tokens
+			SET revoked_at = NOW()
+			WHERE session_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING jti, expires_at
+		)
+	`+notifyRevokedAccessTokens, sessionID)
+
+	return err
+}
+
+func revokeUserSessions(ctx context.Context, q execer, userID string) error {
+	_, err := q.Exec(ctx, `
+		WITH revoked_sessions AS (
+			UPDATE sessions SET revoked = true
+			WHERE user_id = $1 AND revoked = false
+		), revoked_refresh AS (
+			UPDATE refresh_tokens
+			SET revoked = true
+			WHERE user_id = $1 AND revoked = false
+		), revoked_access AS (
+			UPDATE access_tokens
+			SET revoked_at = NOW()
+			WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING jti, expires_at
+		)
+	`+notifyRevokedAccessTokens, userID)
+
+	return err
+}
+
+// revokes every session of the user except the given one
+func RevokeOtherSessions(userID string, keepSessionID string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		WITH revoked_sessions AS (
+			UPDATE sessions SET revoked = true
+			WHERE user_id = $1 AND id::text != $2 AND revoked = false
+		), revoked_refresh AS (
+			UPDATE refresh_tokens
+			SET revoked = true
+			WHERE user_id = $1 AND family_id::text != $2 AND revoked = false
+		), revoked_access AS (
+			UPDATE access_tokens
+			SET revoked_at = NOW()
+			WHERE user_id = $1 AND (session_id IS NULL OR session_id::text != $2)
+				AND revoked_at IS NULL AND expires_at > NOW()
+			RETURNING jti, expires_at
+		)
+	`+notifyRevokedAccessTokens, userID, keepSessionID)
+
+	return err
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"backend/core/db"
+	"context"
+	"time"
+)
+
+// returns the totp secret (empty if 2FA was never set up) and whether 2FA is enabled
+func SelectTwoFactorState(userID string) (string, bool, error) {
+	var secret *string
+	var enabled bool
+
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1
+	`, userID).Scan(&secret, &enabled)
+	if err != nil || secret == nil {
+		return "", enabled, err
+	}
+
+	return *secret, enabled, nil
+}
+
+// stores a secret that becomes active only after EnableTwoFactor
+func SetPendingTOTPSecret(userID string, secret string) error {
+	_, err := db.DB.Exec(context.Background(), `
+		UPDATE users
+		SET totp_secret = $1, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $2 AND totp_enabled_at IS NULL`,
+		secret, userID)
+
+	return err
+}
+
+// enables 2FA and replaces the recovery codes of the user
+func EnableTwoFactor(userID string, step int64, recoveryCodeHashes []string) error {
+	ctx := context.Background()
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+		WHERE id = $2`,
+		step, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])`,
+		userID, recoveryCodeHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// remembers the last accepted time step so a code can't be replayed,
+// false is returned if the step was already used
+func UseTOTPStep(userID string, step int64) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+		step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func ConsumeRecoveryCode(userID string, codeHash string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func SaveTwoFactorChallenge(jti string, userID string, expiresAt time.Time) error {
+	_, err := db.DB.Exec(context.Background(), `
+		INSERT INTO two_factor_challenges (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)`,
+		jti, userID, expiresAt)
+
+	return err
+}
+
+// whether the challenge was issued to the user and hasn't been used or expired yet
+func IsTwoFactorChallengePending(jti string, userID string) (bool, error) {
+	var pending bool
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT EXISTS (
+			SELECT 1 FROM two_factor_challenges
+			WHERE jti = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+		)
+	`, jti, userID).Scan(&pending)
+
+	return pending, err
+}
+
+// marks the challenge as used, false is returned if it was already used or expired
+func ConsumeTwoFactorChallenge(jti string, userID string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE two_factor_challenges
+		SET used_at = NOW()
+		WHERE jti = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()`,
+		jti, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
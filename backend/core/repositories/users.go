@@ -3,55 +3,137 @@ package repositories
 import (
 	"backend/core/db"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
 )
 
 type UserInfo struct {
-	ID       int    `json:"id"`
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
+	ID                int      `json:"id"`
+	Email             string   `json:"email"`
+	FullName          string   `json:"full_name"`
+	Verified          bool     `json:"verified"`
+	ProfileVisibility string   `json:"profile_visibility"`
+	Bio               *string  `json:"bio"`
+	Country           *string  `json:"country"`
+	Timezone          *string  `json:"timezone"`
+	BirthYear         *int     `json:"birth_year"`
+	Pronouns          *string  `json:"pronouns"`
+	Interests         []string `json:"interests"`
+	AvatarURL         *string  `json:"avatar_url"`
+	AvatarKey         *string  `json:"-"` // uploaded avatar, takes precedence over AvatarURL
 }
 
+// columns changed by PATCH /users/me, a nil value clears the column
+type ProfileUpdate map[string]any
+
 type Languages struct {
-	Native []int `json:"native"`
-	Target []int `json:"target"`
+	Native []LanguageEntry `json:"native"`
+	Target []LanguageEntry `json:"target"`
+}
+
+// a language with its level, in JSON either a bare id or {"language_id": 1, "level": "B2"}
+type LanguageEntry struct {
+	LanguageID int    `json:"language_id"`
+	Level      string `json:"level,omitempty"`
+}
+
+// CEFR levels from lowest to highest, native languages have the LevelNative level
+var CEFRLevels = []string{"A1", "A2", "B1", "B2", "C1", "C2"}
+
+const LevelNative = "native"
+
+func IsCEFRLevel(level string) bool {
+	return slices.Contains(CEFRLevels, level)
+}
+
+func (e *LanguageEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.LanguageID); err == nil {
+		return nil
+	}
+
+	type entry LanguageEntry
+	return json.Unmarshal(data, (*entry)(e))
 }
 
 func SelectUserInfo(userID string) (UserInfo, error) {
 	var user UserInfo
 
 	err := db.DB.QueryRow(context.Background(), `
-		SELECT id, email, full_name
+		SELECT id, email, full_name, verified_at IS NOT NULL, profile_visibility,
+			bio, country, timezone, birth_year, pronouns, interests, avatar_url, avatar_key
 		FROM users
 		WHERE id = $1
-	`, userID).Scan(&user.ID, &user.Email, &user.FullName)
+	`, userID).Scan(
+		&user.ID, &user.Email, &user.FullName, &user.Verified, &user.ProfileVisibility,
+		&user.Bio, &user.Country, &user.Timezone, &user.BirthYear, &user.Pronouns, &user.Interests, &user.AvatarURL, &user.AvatarKey,
+	)
 
 	return user, err
 }
 
+func IsUserVerified(userID string) (bool, error) {
+	var verified bool
+	err := db.DB.QueryRow(context.Background(), `
+		SELECT verified_at IS NOT NULL FROM users WHERE id = $1
+	`, userID).Scan(&verified)
+
+	return verified, err
+}
+
+// the email is checked so a token issued for an old address can't verify a new one
+func MarkEmailVerified(userID string, email string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		UPDATE users
+		SET verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND email = $2 AND verified_at IS NULL
+	`, userID, email)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
 func SelectUserLanguages(userID string) (pgx.Rows, error) {
 	rows, err := db.DB.Query(context.Background(), `
-		SELECT language_id, type FROM user_languages WHERE user_id = $1
+		SELECT language_id, type, level FROM user_languages WHERE user_id = $1
 	`, userID)
 
 	return rows, err
 }
 
-func SelectTargetedUsers(target string, native string, userID string) (pgx.Rows, error) {
+// minLevel and maxLevel are CEFR levels limiting the level of the target language, or of any
+// target language when target is empty. Only users whose profile the viewer may see are listed,
+// the same rules as services.CanViewProfile
+func SelectTargetedUsers(target string, native string, minLevel string, maxLevel string, userID string) (pgx.Rows, error) {
 	ctx := context.Background()
 
 	baseQuery := `
 		SELECT 
-			u.id, u.email, u.full_name,
-			ul.language_id, ul.type
+			u.id, u.full_name,
+			ul.language_id, ul.type, ul.level
 		FROM users u
 	`
 
 	joins := []string{}
-	conditions := []string{"u.id != $1"}
+	conditions := []string{
+		"u.id != $1",
+		"u.banned_at IS NULL",
+		`NOT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = u.id) OR (blocker_id = u.id AND blocked_id = $1)
+		)`,
+		`(u.profile_visibility = 'public' OR (u.profile_visibility = 'matches' AND EXISTS (
+			SELECT 1 FROM match_requests
+			WHERE status = 'accepted'
+				AND ((from_user_id = $1 AND to_user_id = u.id) OR (from_user_id = u.id AND to_user_id = $1))
+		)))`,
+	}
 	args := []interface{}{userID}
 	argIndex := 2
 
@@ -77,6 +159,30 @@ func SelectTargetedUsers(target string, native string, userID string) (pgx.Rows,
 		argIndex++
 	}
 
+	// a subquery rather than a join, a user with several matching target languages is listed once
+	if minLevel != "" || maxLevel != "" {
+		levels := "ARRAY['" + strings.Join(CEFRLevels, "', '") + "']"
+		levelConditions := []string{"ul_level.user_id = u.id", "ul_level.type = 'target'"}
+
+		if target != "" {
+			levelConditions = append(levelConditions, fmt.Sprintf("ul_level.language_id = $%d", argIndex))
+			args = append(args, target)
+			argIndex++
+		}
+		if minLevel != "" {
+			levelConditions = append(levelConditions, fmt.Sprintf("array_position(%s, ul_level.level) >= array_position(%s, $%d)", levels, levels, argIndex))
+			args = append(args, minLevel)
+			argIndex++
+		}
+		if maxLevel != "" {
+			levelConditions = append(levelConditions, fmt.Sprintf("array_position(%s, ul_level.level) <= array_position(%s, $%d)", levels, levels, argIndex))
+			args = append(args, maxLevel)
+			argIndex++
+		}
+
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM user_languages ul_level WHERE "+strings.Join(levelConditions, " AND ")+")")
+	}
+
 	joins = append(joins, "LEFT JOIN user_languages ul ON ul.user_id = u.id")
 
 	query := baseQuery + strings.Join(joins, "\n") + "\nWHERE " + strings.Join(conditions, " AND ") + "\nORDER BY u.id DESC"
@@ -84,37 +190,123 @@ func SelectTargetedUsers(target string, native string, userID string) (pgx.Rows,
 	return db.DB.Query(ctx, query, args...)
 }
 
-func UpdateSelectedLanguages(userID string, langs Languages) error {
+var ErrUnknownLanguage = errors.New("unknown language")
+
+// replaces all languages of the user, ErrUnknownLanguage when an id doesn't exist
+func ReplaceUserLanguages(userID string, langs Languages) error {
 	ctx := context.Background()
 	var (
+		ids    []int
 		values []string
 		args   []interface{}
 		argPos = 1
 	)
 
-	for _, langID := range langs.Native {
-		values = append(values, fmt.Sprintf("($%d, $%d, 'native')", argPos, argPos+1))
-		args = append(args, userID, langID)
-		argPos += 2
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	for _, langID := range langs.Target {
-		values = append(values, fmt.Sprintf("($%d, $%d, 'target')", argPos, argPos+1))
-		args = append(args, userID, langID)
+	// serializes concurrent replaces of the same user
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return err
+	}
+
+	for _, lang := range append(langs.Native, langs.Target...) {
+		ids = append(ids, lang.LanguageID)
+	}
+
+	var known int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM languages WHERE id = ANY($1)
+	`, ids).Scan(&known)
+	if err != nil {
+		return err
+	}
+	if known != len(ids) {
+		return ErrUnknownLanguage
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_languages WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, lang := range langs.Native {
+		values = append(values, fmt.Sprintf("($%d, $%d, 'native', '%s')", argPos, argPos+1, LevelNative))
+		args = append(args, userID, lang.LanguageID)
 		argPos += 2
 	}
 
+	for _, lang := range langs.Target {
+		var level *string
+		if lang.Level != "" {
+			level = &lang.Level
+		}
+		values = append(values, fmt.Sprintf("($%d, $%d, 'target', $%d)", argPos, argPos+1, argPos+2))
+		args = append(args, userID, lang.LanguageID, level)
+		argPos += 3
+	}
+
 	if len(values) > 0 {
 		query := fmt.Sprintf(`
-			INSERT INTO user_languages (user_id, language_id, type)
+			INSERT INTO user_languages (user_id, language_id, type, level)
 			VALUES %s
-			ON CONFLICT (user_id, language_id, type) DO NOTHING
 		`, strings.Join(values, ", "))
-		_, err := db.DB.Exec(ctx, query, args...)
-		if err != nil {
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tx.Commit(ctx)
+}
+
+func DeleteUserLanguage(userID string, languageID string) (bool, error) {
+	tag, err := db.DB.Exec(context.Background(), `
+		DELETE FROM user_languages WHERE user_id = $1 AND language_id = $2
+	`, userID, languageID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// columns that can be set through a ProfileUpdate
+var profileColumns = []string{"full_name", "bio", "country", "timezone", "birth_year", "pronouns", "interests", "avatar_url"}
+
+// updates only the columns present in the update
+func UpdateProfile(userID string, update ProfileUpdate) error {
+	sets := []string{"updated_at = NOW()"}
+	args := []interface{}{userID}
+
+	for _, column := range profileColumns {
+		value, ok := update[column]
+		if !ok {
+			continue
+		}
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	_, err := db.DB.Exec(context.Background(),
+		"UPDATE users SET "+strings.Join(sets, ", ")+" WHERE id = $1",
+		args...)
+
+	return err
+}
+
+// sets the key of the uploaded avatar, nil removes it. The previous key is returned so its
+// blobs can be deleted
+func UpdateAvatarKey(userID string, avatarKey *string) (*string, error) {
+	var previous *string
+	err := db.DB.QueryRow(context.Background(), `
+		UPDATE users u
+		SET avatar_key = $1, updated_at = NOW()
+		FROM (SELECT id, avatar_key FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.avatar_key
+	`, avatarKey, userID).Scan(&previous)
+
+	return previous, err
 }
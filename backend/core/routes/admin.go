@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"backend/core/handlers"
+	"backend/core/middlewares"
+	"backend/core/services"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func SetupAdminRoutes(app *fiber.App) {
+	group := app.Group("/admin")
+
+	group.Get("/lockouts", handlers.GetLockoutEvents, middlewares.IsAuthorized, middlewares.RequirePermission(services.PermissionLockoutsRead))
+	group.Put("/users/:id/role", handlers.PutUserRole, middlewares.IsAuthorized, middlewares.RequirePermission(services.PermissionUsersManageRoles))
+	group.Put("/users/:id/ban", handlers.BanUser, middlewares.IsAuthorized, middlewares.RequirePermission(services.PermissionUsersBan))
+	group.Delete("/users/:id/ban", handlers.UnbanUser, middlewares.IsAuthorized, middlewares.RequirePermission(services.PermissionUsersBan))
+}
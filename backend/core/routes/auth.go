@@ -2,6 +2,7 @@ package routes
 
 import (
 	"backend/core/handlers"
+	"backend/core/middlewares"
 	"backend/core/middlewares/validators"
 
 	"github.com/gofiber/fiber/v3"
@@ -12,6 +13,24 @@ func SetupAuthRoutes(app *fiber.App) {
 
 	group.Post("/register", handlers.Register, validators.ValidateRegisterInfo)
 	group.Post("/login", handlers.Login, validators.ValidateLoginInfo)
+	group.Get("/oidc/providers", handlers.GetOIDCProviders)
+	group.Get("/oidc/:provider/authorize", handlers.StartOIDCLogin)
+	group.Post("/oidc/:provider/callback", handlers.FinishOIDCLogin)
+	group.Post("/2fa/setup", handlers.SetupTwoFactor, middlewares.IsAuthorized)
+	group.Post("/2fa/enable", handlers.EnableTwoFactor, middlewares.IsAuthorized)
+	group.Post("/2fa/verify", handlers.VerifyTwoFactor)
+	group.Post("/verify-email", handlers.VerifyEmail)
+	group.Post("/resend-verification", handlers.ResendVerification, middlewares.IsAuthorized)
+	group.Post("/email/confirm", handlers.ConfirmEmailChange)
+	group.Post("/password/forgot", handlers.ForgotPassword, validators.ValidateEmailInfo)
+	group.Post("/password/reset", handlers.ResetPassword, validators.ValidateResetPasswordInfo)
+	group.Post("/magic-link", handlers.RequestMagicLink, validators.ValidateEmailInfo)
+	group.Post("/magic-link/consume", handlers.ConsumeMagicLink)
+	group.Post("/logout", handlers.Logout)
+	group.Post("/logout-all", handlers.LogoutAll, middlewares.IsAuthorized)
+	group.Get("/sessions", handlers.GetSessions, middlewares.IsAuthorized)
+	group.Delete("/sessions/:id", handlers.DeleteSession, middlewares.IsAuthorized)
 	group.Post("/token/verify", handlers.ValidateToken)
 	group.Post("/token/refresh", handlers.RefreshAccessToken)
+	group.Post("/token/revoke", handlers.Logout)
 }
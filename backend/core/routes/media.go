@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"backend/core/handlers"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func SetupMediaRoutes(app *fiber.App) {
+	app.Get("/media/*", handlers.ServeMedia)
+}
@@ -4,6 +4,7 @@ import (
 	"backend/core/handlers"
 	"backend/core/middlewares"
 	"backend/core/middlewares/validators"
+	"backend/core/services"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -11,10 +12,13 @@ import (
 func SetupRequestsRoutes(app *fiber.App) {
 	group := app.Group("/requests")
 
-	group.Post("/", handlers.CreateMatchRequest, middlewares.IsAuthorized, validators.ValidatePostMatchRequest)
-	group.Get("/incoming", handlers.GetIncomingMatchRequest, middlewares.IsAuthorized)
-	group.Get("/outgoing", handlers.GetOutgoingMatchRequest, middlewares.IsAuthorized)
-	group.Get("/matches/", handlers.GetAcceptedMatchRequest, middlewares.IsAuthorized)
-	group.Put("/:id/accept", handlers.PutAcceptMatchRequest, middlewares.IsAuthorized, validators.ValidateMatchOwnership)
-	group.Put("/:id/decline", handlers.PutDeclineMatchRequest, middlewares.IsAuthorized, validators.ValidateMatchOwnership)
+	requestsRead := middlewares.RequireScope(services.ScopeRequestsRead)
+	requestsWrite := middlewares.RequireScope(services.ScopeRequestsWrite)
+
+	group.Post("/", handlers.CreateMatchRequest, requestsWrite, middlewares.IsAuthorized, middlewares.IsVerified, validators.ValidatePostMatchRequest)
+	group.Get("/incoming", handlers.GetIncomingMatchRequest, requestsRead, middlewares.IsAuthorized)
+	group.Get("/outgoing", handlers.GetOutgoingMatchRequest, requestsRead, middlewares.IsAuthorized)
+	group.Get("/matches/", handlers.GetAcceptedMatchRequest, requestsRead, middlewares.IsAuthorized)
+	group.Put("/:id/accept", handlers.PutAcceptMatchRequest, requestsWrite, middlewares.IsAuthorized, validators.ValidateMatchOwnership)
+	group.Put("/:id/decline", handlers.PutDeclineMatchRequest, requestsWrite, middlewares.IsAuthorized, validators.ValidateMatchOwnership)
 }
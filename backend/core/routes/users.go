@@ -4,6 +4,7 @@ import (
 	"backend/core/handlers"
 	"backend/core/middlewares"
 	"backend/core/middlewares/validators"
+	"backend/core/services"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -11,7 +12,23 @@ import (
 func SetupUsersRoutes(app *fiber.App) {
 	group := app.Group("/users")
 
-	group.Get("/", handlers.GetTargetedUsers, middlewares.IsAuthorized)
-	group.Get("/me", handlers.GetUserInfo, middlewares.IsAuthorized)
-	group.Put("/me/languages", handlers.UpdateUserLanguages, middlewares.IsAuthorized, validators.ValidateLanguages)
+	usersRead := middlewares.RequireScope(services.ScopeUsersRead)
+	usersWrite := middlewares.RequireScope(services.ScopeUsersWrite)
+
+	group.Get("/", handlers.GetTargetedUsers, usersRead, middlewares.IsAuthorized)
+	group.Get("/me", handlers.GetUserInfo, usersRead, middlewares.IsAuthorized)
+	group.Patch("/me", handlers.PatchUserInfo, usersWrite, middlewares.IsAuthorized, validators.ValidateProfileUpdate)
+	group.Get("/:id<int>", handlers.GetUserProfile, usersRead, middlewares.IsAuthorized)
+	group.Put("/:id<int>/block", handlers.BlockUser, usersWrite, middlewares.IsAuthorized)
+	group.Delete("/:id<int>/block", handlers.UnblockUser, usersWrite, middlewares.IsAuthorized)
+	group.Put("/me/avatar", handlers.PutAvatar, usersWrite, middlewares.IsAuthorized, validators.ValidateAvatarUpload)
+	group.Delete("/me/avatar", handlers.DeleteAvatar, usersWrite, middlewares.IsAuthorized)
+	group.Put("/me/visibility", handlers.PutProfileVisibility, usersWrite, middlewares.IsAuthorized, validators.ValidateProfileVisibility)
+	group.Put("/me/password", handlers.ChangePassword, middlewares.IsAuthorized, validators.ValidateChangePasswordInfo)
+	group.Put("/me/email", handlers.ChangeEmail, middlewares.IsAuthorized, validators.ValidateChangeEmailInfo)
+	group.Put("/me/languages", handlers.UpdateUserLanguages, usersWrite, middlewares.IsAuthorized, validators.ValidateLanguages)
+	group.Delete("/me/languages/:language_id<int>", handlers.DeleteUserLanguage, usersWrite, middlewares.IsAuthorized)
+	group.Get("/me/api-keys", handlers.GetAPIKeys, middlewares.IsAuthorized)
+	group.Post("/me/api-keys", handlers.CreateAPIKey, middlewares.IsAuthorized, validators.ValidateCreateAPIKey)
+	group.Delete("/me/api-keys/:id", handlers.DeleteAPIKey, middlewares.IsAuthorized)
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"backend/core/handlers"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func SetupWellKnownRoutes(app *fiber.App) {
+	group := app.Group("/.well-known")
+
+	group.Get("/jwks.json", handlers.GetJWKS)
+}
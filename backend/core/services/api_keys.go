@@ -0,0 +1,67 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// scopes an API key can be granted, routes declare the one they need
+const (
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+	ScopeRequestsRead  = "requests:read"
+	ScopeRequestsWrite = "requests:write"
+)
+
+var APIKeyScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeRequestsRead, ScopeRequestsWrite}
+
+const apiKeyPrefix = "lx"
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+func IsValidAPIKeyScope(scope string) bool {
+	return slices.Contains(APIKeyScopes, scope)
+}
+
+// generates a key formatted as lx_<prefix>_<secret>, only its hash is stored
+// so the key is returned to the user once
+func CreateAPIKey(userID string, name string, scopes []string, expiresAt *time.Time) (string, int, string, time.Time, error) {
+	prefixBytes := make([]byte, 6)
+	rand.Read(prefixBytes)
+	secretBytes := make([]byte, 32)
+	rand.Read(secretBytes)
+
+	prefix := base64.RawURLEncoding.EncodeToString(prefixBytes)
+	key := apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	id, createdAt, err := repositories.InsertAPIKey(userID, name, prefix, HashToken(key), scopes, expiresAt)
+	if err != nil {
+		return "", 0, "", time.Time{}, err
+	}
+
+	return key, id, prefix, createdAt, nil
+}
+
+// returns the owner, their role and the scopes of the key
+func AuthenticateAPIKey(key string) (string, string, []string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix+"_") {
+		return "", "", nil, ErrInvalidAPIKey
+	}
+
+	userID, role, scopes, err := repositories.UseAPIKey(HashToken(key))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", nil, ErrInvalidAPIKey
+		}
+		return "", "", nil, err
+	}
+
+	return userID, role, scopes, nil
+}
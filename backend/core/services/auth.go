@@ -1,8 +1,10 @@
 package services
 
 import (
+	"backend/core/passwords"
 	"backend/core/repositories"
 	"fmt"
+	"log"
 )
 
 func RegisterUser(username string, password string, email string) error {
@@ -11,12 +13,17 @@ func RegisterUser(username string, password string, email string) error {
 		return err
 	}
 
-	err = repositories.CreateUser(username, hashedPassword, email)
+	userID, err := repositories.CreateUser(username, hashedPassword, email)
 
 	if err != nil {
 		return err
 	}
 
+	// the account is usable without verification, so a mail failure isn't fatal
+	if err := SendVerificationEmail(userID, email); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", userID, err)
+	}
+
 	return nil
 }
 
@@ -31,5 +38,22 @@ func LoginUser(email string, password string) (*repositories.User, string, error
 		return nil, "", fmt.Errorf("invalid password")
 	}
 
+	// upgrades hashes made with an older algorithm or weaker parameters, the login succeeds anyway
+	if passwords.DefaultHasher.NeedsRehash(userPassword) {
+		if err := rehashPassword(userID, password, userPassword); err != nil {
+			log.Printf("Failed to rehash password of user %s: %v", userID, err)
+		}
+	}
+
 	return &repositories.User{ID: userID}, username, nil
 }
+
+// the new hash replaces only the verified one, a concurrent password change or reset wins
+func rehashPassword(userID string, password string, verifiedHash string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = repositories.ReplacePasswordHash(userID, verifiedHash, hashedPassword)
+	return err
+}
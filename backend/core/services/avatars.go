@@ -0,0 +1,87 @@
+package services
+
+import (
+	"backend/core/images"
+	"backend/core/repositories"
+	"backend/core/storage"
+	"backend/main/config"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+)
+
+// sizes of the stored avatar thumbnails, the first one is the main avatar
+var avatarSizes = []int{256, 64}
+
+// stores thumbnails of the image as the user's avatar and deletes the previous one.
+// Errors of the images package mean the upload itself is invalid
+func UploadAvatar(ctx context.Context, userID string, data []byte) error {
+	thumbnails, err := images.Thumbnails(data, avatarSizes)
+	if err != nil {
+		return err
+	}
+
+	// a new key per upload, so cached URLs of the old avatar never show the new one
+	key := fmt.Sprintf("avatars/%s/%s", userID, rand.Text())
+	for _, size := range avatarSizes {
+		if err := storage.Default.Put(ctx, avatarBlobKey(key, size), "image/jpeg", thumbnails[size]); err != nil {
+			deleteAvatarBlobs(ctx, key)
+			return err
+		}
+	}
+
+	previous, err := repositories.UpdateAvatarKey(userID, &key)
+	if err != nil {
+		deleteAvatarBlobs(ctx, key)
+		return err
+	}
+	if previous != nil {
+		deleteAvatarBlobs(ctx, *previous)
+	}
+	return nil
+}
+
+func DeleteAvatar(ctx context.Context, userID string) error {
+	previous, err := repositories.UpdateAvatarKey(userID, nil)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		deleteAvatarBlobs(ctx, *previous)
+	}
+	return nil
+}
+
+// URLs of the avatar and its small thumbnail. Uploaded avatars get signed URLs, otherwise
+// the external avatar_url is used for both
+func AvatarURLs(user repositories.UserInfo) (*string, *string) {
+	if user.AvatarKey == nil {
+		return user.AvatarURL, user.AvatarURL
+	}
+
+	expiresAt := storage.URLExpiry(config.MEDIA_URL_TTL)
+	urls := make([]*string, len(avatarSizes))
+	for i, size := range avatarSizes {
+		url, err := storage.Default.URL(avatarBlobKey(*user.AvatarKey, size), expiresAt)
+		if err != nil {
+			log.Printf("Failed to sign avatar URL of user %d: %v", user.ID, err)
+			return user.AvatarURL, user.AvatarURL
+		}
+		urls[i] = &url
+	}
+	return urls[0], urls[len(urls)-1]
+}
+
+func avatarBlobKey(key string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", key, size)
+}
+
+// failures only leave orphaned files behind, so they are logged
+func deleteAvatarBlobs(ctx context.Context, key string) {
+	for _, size := range avatarSizes {
+		if err := storage.Default.Delete(ctx, avatarBlobKey(key, size)); err != nil {
+			log.Printf("Failed to delete avatar blob %s: %v", avatarBlobKey(key, size), err)
+		}
+	}
+}
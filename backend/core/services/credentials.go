@@ -0,0 +1,139 @@
+package services
+
+import (
+	"backend/core/mailer"
+	"backend/core/repositories"
+	"backend/main/config"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+var (
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrEmailTaken      = errors.New("email is already in use")
+)
+
+// changes the password of an authorized user and ends all other sessions
+func ChangePassword(userID string, sessionID string, currentPassword string, newPassword string) error {
+	passwordHash, err := repositories.SelectPasswordHash(userID)
+	if err != nil {
+		return err
+	}
+
+	if !CheckPassword(currentPassword, passwordHash) {
+		return ErrInvalidPassword
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := repositories.UpdatePasswordHash(userID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := repositories.InvalidateOneTimeTokens(userID, repositories.PurposePasswordReset); err != nil {
+		return err
+	}
+
+	return repositories.RevokeOtherSessions(userID, sessionID)
+}
+
+// sends a confirmation link to the new address and a notice to the old one,
+// the email is replaced only after the link is opened
+func RequestEmailChange(userID string, password string, newEmail string) error {
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := repositories.SelectPasswordHash(userID)
+	if err != nil {
+		return err
+	}
+
+	if !CheckPassword(password, passwordHash) {
+		return ErrInvalidPassword
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailTaken
+	}
+
+	_, err = repositories.SelectUserIDByEmail(newEmail)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if err := repositories.InvalidateOneTimeTokens(userID, repositories.PurposeEmailChange); err != nil {
+		return err
+	}
+
+	token, tokenHash := GenerateOneTimeToken(repositories.PurposeEmailChange)
+	expiresAt := time.Now().Add(emailChangeTTL)
+
+	err = repositories.SaveOneTimeToken(userID, repositories.PurposeEmailChange, tokenHash, newEmail, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", config.APP_URL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Confirm that you want to use this address for your account by opening the link below:\n\n%s\n\n"+
+			"The link expires in 24 hours.",
+		link,
+	)
+	if err := mailer.Send(newEmail, "Confirm your new email address", body); err != nil {
+		return err
+	}
+
+	notice := fmt.Sprintf(
+		"A request was made to change the email address of your account to %s.\n\n"+
+			"The change takes effect once the new address is confirmed. If it wasn't you, change your password immediately.",
+		newEmail,
+	)
+	return mailer.Send(user.Email, "Your email address is being changed", notice)
+}
+
+func ConfirmEmailChange(token string) error {
+	tokenHash, err := VerifyOneTimeToken(repositories.PurposeEmailChange, token)
+	if err != nil {
+		return err
+	}
+
+	userID, email, err := repositories.ConsumeOneTimeToken(repositories.PurposeEmailChange, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidOneTimeToken
+		}
+		return err
+	}
+
+	err = repositories.UpdateEmail(userID, email)
+	if err != nil {
+		if strings.Contains(err.Error(), "23505") {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	// links already sent to the old address must stop working
+	for _, purpose := range []string{repositories.PurposePasswordReset, repositories.PurposeMagicLink} {
+		if err := repositories.InvalidateOneTimeTokens(userID, purpose); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrAccessTokenRevoked = errors.New("access token has been revoked")
+
+// how long to wait before listening again after the notification connection failed
+const denylistReconnectDelay = 5 * time.Second
+
+// revoked access tokens by jti with their expiry. It is loaded from the database and kept
+// in sync across instances through LISTEN/NOTIFY, so checking a token needs no query
+var denylist = struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}{entries: make(map[string]time.Time)}
+
+func IsAccessTokenRevoked(jti string) bool {
+	denylist.mu.RLock()
+	defer denylist.mu.RUnlock()
+
+	_, revoked := denylist.entries[jti]
+	return revoked
+}
+
+func InitAccessTokenDenylist() {
+	go func() {
+		for {
+			err := repositories.ListenAccessTokenRevocations(context.Background(), reloadDenylist, addDenylistEntry)
+			log.Printf("Access token denylist listener stopped: %v", err)
+			time.Sleep(denylistReconnectDelay)
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			pruneDenylist()
+		}
+	}()
+}
+
+func reloadDenylist() error {
+	rows, err := repositories.SelectRevokedAccessTokens()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	entries := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return err
+		}
+		entries[jti] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	denylist.mu.Lock()
+	denylist.entries = entries
+	denylist.mu.Unlock()
+
+	return nil
+}
+
+// payload is "<jti> <expires unix>"
+func addDenylistEntry(payload string) {
+	jti, expires, ok := strings.Cut(payload, " ")
+	if !ok {
+		return
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return
+	}
+
+	denylist.mu.Lock()
+	denylist.entries[jti] = time.Unix(unix, 0)
+	denylist.mu.Unlock()
+}
+
+// drops tokens that expired, they are rejected by their exp claim anyway
+func pruneDenylist() {
+	now := time.Now()
+
+	denylist.mu.Lock()
+	defer denylist.mu.Unlock()
+
+	for jti, expiresAt := range denylist.entries {
+		if now.After(expiresAt.Add(time.Minute)) {
+			delete(denylist.entries, jti)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"backend/main/config"
+	"log"
+	"time"
+)
+
+// sessions younger than this are never purged, their first refresh token may not be saved yet
+const sessionPurgeGracePeriod = time.Hour
+
+// periodically deletes expired and revoked token rows, disabled when the interval is 0
+func InitTokenJanitor() {
+	if config.TOKEN_JANITOR_INTERVAL <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.TOKEN_JANITOR_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			PurgeStaleTokens()
+			<-ticker.C
+		}
+	}()
+}
+
+// runs every purge once, a failing purge is logged and doesn't stop the others
+func PurgeStaleTokens() {
+	purges := []struct {
+		name  string
+		purge func() (int64, error)
+	}{
+		{"refresh tokens", repositories.DeleteStaleRefreshTokens},
+		{"sessions", func() (int64, error) { return repositories.DeleteStaleSessions(sessionPurgeGracePeriod) }},
+		{"access tokens", repositories.DeleteExpiredAccessTokens},
+		{"one-time tokens", repositories.DeleteStaleOneTimeTokens},
+		{"oidc states", repositories.DeleteExpiredOIDCStates},
+		{"two-factor challenges", repositories.DeleteStaleTwoFactorChallenges},
+		{"login attempts", func() (int64, error) { return repositories.DeleteStaleLoginAttempts(loginFailureResetAfter) }},
+	}
+
+	for _, p := range purges {
+		deleted, err := p.purge()
+		if err != nil {
+			log.Printf("Failed to purge stale %s: %v", p.name, err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Purged %d stale %s", deleted, p.name)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"backend/main/config"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// failures are forgotten once there were none for this long
+const loginFailureResetAfter = 24 * time.Hour
+
+type AttemptPolicy struct {
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+}
+
+// returns until when attempts are blocked after the given number of failures,
+// the bool is true when it is a lockout rather than an exponential backoff
+func (p AttemptPolicy) blockAfter(failures int, now time.Time) (time.Time, bool) {
+	if failures >= p.MaxFailures {
+		return now.Add(p.LockoutDuration), true
+	}
+
+	delay := p.MaxDelay
+	if failures < 32 {
+		if d := p.BaseDelay << (failures - 1); d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	return now.Add(delay), false
+}
+
+// stores login attempts per key (account or ip). Attempts are counted before the credentials
+// are checked so parallel guesses can't slip past the limit
+type AttemptTracker interface {
+	// counts an attempt unless the key is blocked and returns the attempts including this one,
+	// or zero and the end of the block. After a block expired the count doesn't go past maxFailures
+	Count(key string, maxFailures int) (int, time.Time, error)
+	Block(key string, blockedUntil time.Time) error
+	// takes back an attempt that turned out to be successful
+	Refund(key string) error
+	Reset(key string) error
+}
+
+// keeps attempts in the database so every instance shares them
+type PostgresAttemptTracker struct{}
+
+func (PostgresAttemptTracker) Count(key string, maxFailures int) (int, time.Time, error) {
+	attempts, err := repositories.IncrementLoginFailures(key, loginFailureResetAfter, maxFailures)
+	if err == nil {
+		return attempts, time.Time{}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, time.Time{}, err
+	}
+
+	_, _, blockedUntil, err := repositories.SelectLoginAttempt(key)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return 0, blockedUntil, nil
+}
+
+func (PostgresAttemptTracker) Block(key string, blockedUntil time.Time) error {
+	return repositories.BlockLoginAttempts(key, blockedUntil)
+}
+
+func (PostgresAttemptTracker) Refund(key string) error {
+	return repositories.RefundLoginFailure(key)
+}
+
+func (PostgresAttemptTracker) Reset(key string) error {
+	return repositories.DeleteLoginAttempts(key)
+}
+
+type memoryAttempt struct {
+	failures      int
+	lastFailureAt time.Time
+	blockedUntil  time.Time
+}
+
+// keeps attempts in process memory, suitable for a single instance
+type MemoryAttemptTracker struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempt
+}
+
+func NewMemoryAttemptTracker() *MemoryAttemptTracker {
+	return &MemoryAttemptTracker{attempts: make(map[string]*memoryAttempt)}
+}
+
+func (t *MemoryAttemptTracker) Count(key string, maxFailures int) (int, time.Time, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	attempt, ok := t.attempts[key]
+	if !ok || now.Sub(attempt.lastFailureAt) > loginFailureResetAfter {
+		attempt = &memoryAttempt{}
+		t.attempts[key] = attempt
+		t.prune(now)
+	}
+
+	if now.Before(attempt.blockedUntil) {
+		return 0, attempt.blockedUntil, nil
+	}
+
+	attempt.failures++
+	if !attempt.blockedUntil.IsZero() {
+		attempt.failures = min(attempt.failures, maxFailures)
+		attempt.blockedUntil = time.Time{}
+	}
+	attempt.lastFailureAt = now
+
+	return attempt.failures, time.Time{}, nil
+}
+
+func (t *MemoryAttemptTracker) Block(key string, blockedUntil time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if attempt, ok := t.attempts[key]; ok && blockedUntil.After(attempt.blockedUntil) {
+		attempt.blockedUntil = blockedUntil
+	}
+	return nil
+}
+
+func (t *MemoryAttemptTracker) Refund(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if attempt, ok := t.attempts[key]; ok && attempt.failures > 0 {
+		attempt.failures--
+	}
+	return nil
+}
+
+func (t *MemoryAttemptTracker) Reset(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+	return nil
+}
+
+// drops forgotten attempts once the map grows, mutex must be held
+func (t *MemoryAttemptTracker) prune(now time.Time) {
+	if len(t.attempts) < 10000 {
+		return
+	}
+	for key, attempt := range t.attempts {
+		if now.Sub(attempt.lastFailureAt) > loginFailureResetAfter {
+			delete(t.attempts, key)
+		}
+	}
+}
+
+// applies backoff and lockouts to logins per account and per ip
+type LoginGuard struct {
+	Tracker AttemptTracker
+	Account AttemptPolicy
+	IP      AttemptPolicy
+}
+
+var Guard *LoginGuard
+
+func InitLoginGuard() {
+	var tracker AttemptTracker
+	switch config.LOGIN_TRACKER {
+	case "postgres":
+		tracker = PostgresAttemptTracker{}
+	case "memory":
+		tracker = NewMemoryAttemptTracker()
+	default:
+		log.Fatalf("Unknown LOGIN_TRACKER %q, expected postgres or memory", config.LOGIN_TRACKER)
+	}
+
+	Guard = &LoginGuard{
+		Tracker: tracker,
+		Account: AttemptPolicy{
+			MaxFailures:     config.LOGIN_MAX_FAILURES,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+			LockoutDuration: config.LOGIN_LOCKOUT_DURATION,
+		},
+		IP: AttemptPolicy{
+			MaxFailures:     config.LOGIN_IP_MAX_FAILURES,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutDuration: config.LOGIN_LOCKOUT_DURATION,
+		},
+	}
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+func secondFactorAttemptKey(userID string) string {
+	return "2fa:" + userID
+}
+
+type attemptScope struct {
+	scope   string
+	subject string
+	key     string
+	policy  AttemptPolicy
+	// the account is cleared on success, the ip only gets its attempt back
+	resetOnSuccess bool
+	attempts       int
+}
+
+// an attempt counted by Begin, finished with Fail or Succeed once the credentials are checked
+type LoginAttempt struct {
+	guard  *LoginGuard
+	ip     string
+	scopes []attemptScope
+}
+
+// counts a login attempt for the account and the ip, a positive duration means the client
+// has to wait that long and the attempt must not be made
+func (g *LoginGuard) BeginLogin(email string, ip string) (*LoginAttempt, time.Duration, error) {
+	return g.begin(ip,
+		attemptScope{scope: "account", subject: strings.ToLower(email), key: accountAttemptKey(email), policy: g.Account, resetOnSuccess: true},
+		attemptScope{scope: "ip", subject: ip, key: ipAttemptKey(ip), policy: g.IP},
+	)
+}
+
+// same as BeginLogin for the second step of the login, guessed codes are counted per user
+func (g *LoginGuard) BeginSecondFactor(userID string, ip string) (*LoginAttempt, time.Duration, error) {
+	return g.begin(ip,
+		attemptScope{scope: "two_factor", subject: userID, key: secondFactorAttemptKey(userID), policy: g.Account, resetOnSuccess: true},
+		attemptScope{scope: "ip", subject: ip, key: ipAttemptKey(ip), policy: g.IP},
+	)
+}
+
+func (g *LoginGuard) begin(ip string, scopes ...attemptScope) (*LoginAttempt, time.Duration, error) {
+	attempt := &LoginAttempt{guard: g, ip: ip}
+	var wait time.Duration
+
+	for _, s := range scopes {
+		attempts, blockedUntil, err := g.Tracker.Count(s.key, s.policy.MaxFailures)
+		if err != nil {
+			attempt.refund()
+			return nil, 0, err
+		}
+
+		if attempts == 0 {
+			wait = max(wait, time.Until(blockedUntil), time.Second)
+			continue
+		}
+		// more parallel attempts than allowed, the lockout starts right away
+		if attempts > s.policy.MaxFailures {
+			if err := g.Tracker.Block(s.key, time.Now().Add(s.policy.LockoutDuration)); err != nil {
+				attempt.refund()
+				return nil, 0, err
+			}
+			wait = max(wait, s.policy.LockoutDuration)
+			continue
+		}
+
+		s.attempts = attempts
+		attempt.scopes = append(attempt.scopes, s)
+	}
+
+	if wait > 0 {
+		attempt.refund()
+		return nil, wait, nil
+	}
+	return attempt, 0, nil
+}
+
+// blocks further attempts with a backoff and records lockouts
+func (a *LoginAttempt) Fail() error {
+	for _, s := range a.scopes {
+		blockedUntil, locked := s.policy.blockAfter(s.attempts, time.Now())
+		if err := a.guard.Tracker.Block(s.key, blockedUntil); err != nil {
+			return err
+		}
+		if !locked {
+			continue
+		}
+
+		log.Printf("Login locked for %s %s until %v after %d failures", s.scope, s.subject, blockedUntil, s.attempts)
+		if err := repositories.InsertLockoutEvent(s.scope, s.subject, a.ip, s.attempts, blockedUntil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clears the failures of the account, the ip keeps its earlier failures
+func (a *LoginAttempt) Succeed() error {
+	for _, s := range a.scopes {
+		var err error
+		if s.resetOnSuccess {
+			err = a.guard.Tracker.Reset(s.key)
+		} else {
+			err = a.guard.Tracker.Refund(s.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// takes back the attempts counted before another scope refused it
+func (a *LoginAttempt) refund() {
+	for _, s := range a.scopes {
+		if err := a.guard.Tracker.Refund(s.key); err != nil {
+			log.Println(err)
+		}
+	}
+}
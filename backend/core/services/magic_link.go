@@ -0,0 +1,80 @@
+package services
+
+import (
+	"backend/core/mailer"
+	"backend/core/repositories"
+	"backend/main/config"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// emails a single-use login link if the account exists, unknown emails are silently ignored
+func RequestMagicLink(email string) error {
+	userID, err := repositories.SelectUserIDByEmail(email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if err := repositories.InvalidateOneTimeTokens(userID, repositories.PurposeMagicLink); err != nil {
+		return err
+	}
+
+	token, tokenHash := GenerateOneTimeToken(repositories.PurposeMagicLink)
+	expiresAt := time.Now().Add(magicLinkTTL)
+
+	err = repositories.SaveOneTimeToken(userID, repositories.PurposeMagicLink, tokenHash, email, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", config.APP_URL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Open the link below to sign in:\n\n%s\n\n"+
+			"The link expires in 15 minutes and works only once. If you didn't request it, ignore this email.",
+		link,
+	)
+
+	return mailer.Send(email, "Your sign-in link", body)
+}
+
+// returns the user the link was issued for, opening the link also proves the email belongs to them
+func ConsumeMagicLink(token string) (string, error) {
+	tokenHash, err := VerifyOneTimeToken(repositories.PurposeMagicLink, token)
+	if err != nil {
+		return "", err
+	}
+
+	userID, email, err := repositories.ConsumeOneTimeToken(repositories.PurposeMagicLink, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidOneTimeToken
+		}
+		return "", err
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return "", err
+	}
+	// the link was sent to an address the account no longer uses
+	if user.Email != email {
+		return "", ErrInvalidOneTimeToken
+	}
+
+	if !user.Verified {
+		if _, err := repositories.MarkEmailVerified(userID, email); err != nil {
+			return "", err
+		}
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"backend/core/oidc"
+	"backend/core/repositories"
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const OIDCStateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidOIDCState       = errors.New("invalid or expired login state")
+	ErrOIDCEmailMissing       = errors.New("identity provider didn't return an email")
+	ErrOIDCEmailNotVerified   = errors.New("email of the identity is not verified")
+	ErrOIDCAccountNotVerified = errors.New("email of the existing account is not verified")
+	ErrOIDCSignupNotVerified  = errors.New("email of the new identity is not verified")
+)
+
+// accounts and login states used by the OIDC login
+type OIDCStore interface {
+	SaveState(state string, provider string, browserHash string, nonce string, codeVerifier string, expiresAt time.Time) error
+	// returns the nonce and PKCE verifier, pgx.ErrNoRows for unknown, expired or used states
+	// and states of another browser
+	ConsumeState(state string, provider string, browserHash string) (string, string, error)
+	// pgx.ErrNoRows when nothing matches
+	SelectUserIDByIdentity(provider string, subject string) (string, error)
+	SelectUserIDByEmail(email string) (string, error)
+	IsUserVerified(userID string) (bool, error)
+	CreateUser(fullName string, passwordHash string, email string) (string, error)
+	InsertIdentity(userID string, provider string, subject string, email string) error
+	MarkEmailVerified(userID string, email string) error
+}
+
+type PostgresOIDCStore struct{}
+
+func (PostgresOIDCStore) SaveState(state string, provider string, browserHash string, nonce string, codeVerifier string, expiresAt time.Time) error {
+	return repositories.SaveOIDCState(state, provider, browserHash, nonce, codeVerifier, expiresAt)
+}
+
+func (PostgresOIDCStore) ConsumeState(state string, provider string, browserHash string) (string, string, error) {
+	return repositories.ConsumeOIDCState(state, provider, browserHash)
+}
+
+func (PostgresOIDCStore) SelectUserIDByIdentity(provider string, subject string) (string, error) {
+	return repositories.SelectUserIDByIdentity(provider, subject)
+}
+
+func (PostgresOIDCStore) SelectUserIDByEmail(email string) (string, error) {
+	return repositories.SelectUserIDByEmail(email)
+}
+
+func (PostgresOIDCStore) IsUserVerified(userID string) (bool, error) {
+	return repositories.IsUserVerified(userID)
+}
+
+func (PostgresOIDCStore) CreateUser(fullName string, passwordHash string, email string) (string, error) {
+	return repositories.CreateUser(fullName, passwordHash, email)
+}
+
+func (PostgresOIDCStore) InsertIdentity(userID string, provider string, subject string, email string) error {
+	return repositories.InsertIdentity(userID, provider, subject, email)
+}
+
+func (PostgresOIDCStore) MarkEmailVerified(userID string, email string) error {
+	_, err := repositories.MarkEmailVerified(userID, email)
+	return err
+}
+
+var OIDCAccounts OIDCStore = PostgresOIDCStore{}
+
+// returns the provider login url and a browser key, state, nonce and PKCE verifier are kept
+// until the callback. The key has to be kept by the browser that started the login and sent
+// with the callback, so a code and state obtained by someone else can't be completed in it
+func StartOIDCLogin(ctx context.Context, providerName string) (string, string, error) {
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	state := oidc.RandomString()
+	nonce := oidc.RandomString()
+	codeVerifier := oidc.RandomString()
+	browserKey := oidc.RandomString()
+
+	err = OIDCAccounts.SaveState(state, providerName, HashToken(browserKey), nonce, codeVerifier, time.Now().Add(OIDCStateTTL))
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, browserKey, nil
+}
+
+// exchanges the code and returns the linked user. A new identity is linked to the account
+// with the same email when both sides verified it, or gets a new account when the provider did
+func FinishOIDCLogin(ctx context.Context, providerName string, code string, state string, browserKey string) (string, error) {
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+	if browserKey == "" {
+		return "", ErrInvalidOIDCState
+	}
+
+	nonce, codeVerifier, err := OIDCAccounts.ConsumeState(state, providerName, HashToken(browserKey))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidOIDCState
+		}
+		return "", err
+	}
+
+	claims, err := provider.Exchange(ctx, code, codeVerifier, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	userID, err := OIDCAccounts.SelectUserIDByIdentity(providerName, claims.Subject)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	if claims.Email == "" {
+		return "", ErrOIDCEmailMissing
+	}
+
+	userID, err = OIDCAccounts.SelectUserIDByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// linking to an existing account is safe only when the provider vouches for the email
+		if !claims.EmailVerified {
+			return "", ErrOIDCEmailNotVerified
+		}
+		// anyone can register an address they don't own, linking such an account would let
+		// its creator sign in to the identity owner's account with their password
+		verified, err := OIDCAccounts.IsUserVerified(userID)
+		if err != nil {
+			return "", err
+		}
+		if !verified {
+			return "", ErrOIDCAccountNotVerified
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		// the account would hold an address nobody proved to own, its real owner could later
+		// reset the password while the identity still signs in
+		if !claims.EmailVerified {
+			return "", ErrOIDCSignupNotVerified
+		}
+		userID, err = createOIDCUser(claims)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", err
+	}
+
+	if err := OIDCAccounts.InsertIdentity(userID, providerName, claims.Subject, claims.Email); err != nil {
+		return "", err
+	}
+
+	// both paths above require the provider to have verified the email
+	if err := OIDCAccounts.MarkEmailVerified(userID, claims.Email); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// accounts created through a provider get a random password, it can be set later via reset
+func createOIDCUser(claims *oidc.IDTokenClaims) (string, error) {
+	fullName := strings.TrimSpace(claims.Name)
+	if fullName == "" {
+		fullName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	hashedPassword, err := HashPassword(rand.Text())
+	if err != nil {
+		return "", err
+	}
+
+	return OIDCAccounts.CreateUser(fullName, hashedPassword, claims.Email)
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"backend/core/oidc"
+	"backend/core/oidc/oidctest"
+	"backend/core/passwords"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type memoryOIDCState struct {
+	provider     string
+	browserHash  string
+	nonce        string
+	codeVerifier string
+	expiresAt    time.Time
+}
+
+type memoryOIDCUser struct {
+	email    string
+	verified bool
+}
+
+type memoryOIDCStore struct {
+	mu         sync.Mutex
+	states     map[string]memoryOIDCState
+	users      map[string]*memoryOIDCUser
+	identities map[string]string
+}
+
+func newMemoryOIDCStore() *memoryOIDCStore {
+	return &memoryOIDCStore{
+		states:     make(map[string]memoryOIDCState),
+		users:      make(map[string]*memoryOIDCUser),
+		identities: make(map[string]string),
+	}
+}
+
+func (s *memoryOIDCStore) SaveState(state string, provider string, browserHash string, nonce string, codeVerifier string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = memoryOIDCState{provider, browserHash, nonce, codeVerifier, expiresAt}
+	return nil
+}
+
+func (s *memoryOIDCStore) ConsumeState(state string, provider string, browserHash string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved, ok := s.states[state]
+	if !ok || saved.provider != provider || saved.browserHash != browserHash || time.Now().After(saved.expiresAt) {
+		return "", "", pgx.ErrNoRows
+	}
+	delete(s.states, state)
+	return saved.nonce, saved.codeVerifier, nil
+}
+
+func (s *memoryOIDCStore) SelectUserIDByIdentity(provider string, subject string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID, ok := s.identities[provider+"/"+subject]
+	if !ok {
+		return "", pgx.ErrNoRows
+	}
+	return userID, nil
+}
+
+func (s *memoryOIDCStore) SelectUserIDByEmail(email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, user := range s.users {
+		if user.email == email {
+			return id, nil
+		}
+	}
+	return "", pgx.ErrNoRows
+}
+
+func (s *memoryOIDCStore) IsUserVerified(userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return false, pgx.ErrNoRows
+	}
+	return user.verified, nil
+}
+
+func (s *memoryOIDCStore) CreateUser(fullName string, passwordHash string, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addUser(email, false), nil
+}
+
+func (s *memoryOIDCStore) InsertIdentity(userID string, provider string, subject string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities[provider+"/"+subject] = userID
+	return nil
+}
+
+func (s *memoryOIDCStore) MarkEmailVerified(userID string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[userID]; ok && user.email == email {
+		user.verified = true
+	}
+	return nil
+}
+
+// mutex must be held
+func (s *memoryOIDCStore) addUser(email string, verified bool) string {
+	id := strconv.Itoa(len(s.users) + 1)
+	s.users[id] = &memoryOIDCUser{email: email, verified: verified}
+	return id
+}
+
+const testProvider = "mock"
+
+func setupOIDCTest(t *testing.T) (*oidctest.IdP, *memoryOIDCStore) {
+	t.Helper()
+
+	idp := oidctest.New(t, "test-client")
+	oidc.RegisterProvider(oidc.NewProvider(testProvider, idp.Issuer(), idp.ClientID, "secret", "http://localhost/callback", []string{"openid", "email"}))
+
+	store := newMemoryOIDCStore()
+	previousStore, previousHasher := OIDCAccounts, passwords.DefaultHasher
+	OIDCAccounts = store
+	passwords.DefaultHasher = &passwords.Hasher{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: 4}
+	t.Cleanup(func() {
+		OIDCAccounts, passwords.DefaultHasher = previousStore, previousHasher
+	})
+
+	return idp, store
+}
+
+// runs the code flow through the mock provider, claims end up in the ID token
+func oidcLogin(t *testing.T, idp *oidctest.IdP, claims map[string]any) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	authURL, browserKey, err := StartOIDCLogin(ctx, testProvider)
+	if err != nil {
+		t.Fatalf("StartOIDCLogin() error = %v", err)
+	}
+	code, state, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	return FinishOIDCLogin(ctx, testProvider, code, state, browserKey)
+}
+
+func verifiedIdentity(subject string, email string) map[string]any {
+	return map[string]any{"sub": subject, "email": email, "email_verified": true}
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	idp, store := setupOIDCTest(t)
+
+	userID, err := oidcLogin(t, idp, verifiedIdentity("sub-1", "new@example.com"))
+	if err != nil {
+		t.Fatalf("FinishOIDCLogin() error = %v", err)
+	}
+	if user := store.users[userID]; user == nil || user.email != "new@example.com" || !user.verified {
+		t.Fatalf("created user = %+v, want a verified new@example.com", user)
+	}
+}
+
+func TestOIDCLoginWithLinkedIdentity(t *testing.T) {
+	idp, store := setupOIDCTest(t)
+
+	first, err := oidcLogin(t, idp, verifiedIdentity("sub-1", "user@example.com"))
+	if err != nil {
+		t.Fatalf("first login error = %v", err)
+	}
+	// the subject identifies the user, even when the provider reports another email
+	second, err := oidcLogin(t, idp, map[string]any{"sub": "sub-1", "email": "renamed@example.com", "email_verified": false})
+	if err != nil {
+		t.Fatalf("second login error = %v", err)
+	}
+
+	if first != second {
+		t.Fatalf("second login returned user %s, want %s", second, first)
+	}
+	if len(store.users) != 1 {
+		t.Fatalf("%d users exist, want 1", len(store.users))
+	}
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	idp, store := setupOIDCTest(t)
+	existing := store.addUser("user@example.com", true)
+
+	userID, err := oidcLogin(t, idp, verifiedIdentity("sub-1", "user@example.com"))
+	if err != nil {
+		t.Fatalf("FinishOIDCLogin() error = %v", err)
+	}
+	if userID != existing {
+		t.Fatalf("FinishOIDCLogin() = %s, want the existing user %s", userID, existing)
+	}
+	if linked := store.identities[testProvider+"/sub-1"]; linked != existing {
+		t.Fatalf("identity linked to %q, want %s", linked, existing)
+	}
+}
+
+func TestOIDCLoginRefusesLinking(t *testing.T) {
+	tests := []struct {
+		name            string
+		accountVerified bool
+		emailVerified   any
+		err             error
+	}{
+		{"email not verified by the provider", true, false, ErrOIDCEmailNotVerified},
+		{"email_verified as string", true, "false", ErrOIDCEmailNotVerified},
+		{"email_verified missing", true, nil, ErrOIDCEmailNotVerified},
+		{"account not verified", false, true, ErrOIDCAccountNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, store := setupOIDCTest(t)
+			store.addUser("user@example.com", tt.accountVerified)
+
+			claims := map[string]any{"sub": "sub-1", "email": "user@example.com"}
+			if tt.emailVerified != nil {
+				claims["email_verified"] = tt.emailVerified
+			}
+
+			_, err := oidcLogin(t, idp, claims)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("FinishOIDCLogin() error = %v, want %v", err, tt.err)
+			}
+			if len(store.identities) != 0 {
+				t.Fatalf("identity was linked: %v", store.identities)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedSignup(t *testing.T) {
+	for _, emailVerified := range []any{false, "false", nil} {
+		idp, store := setupOIDCTest(t)
+
+		claims := map[string]any{"sub": "sub-1", "email": "victim@example.com"}
+		if emailVerified != nil {
+			claims["email_verified"] = emailVerified
+		}
+
+		_, err := oidcLogin(t, idp, claims)
+		if !errors.Is(err, ErrOIDCSignupNotVerified) {
+			t.Fatalf("email_verified %v: FinishOIDCLogin() error = %v, want %v", emailVerified, err, ErrOIDCSignupNotVerified)
+		}
+		if len(store.users) != 0 || len(store.identities) != 0 {
+			t.Fatalf("email_verified %v: an account was created", emailVerified)
+		}
+	}
+}
+
+func TestOIDCLoginRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+		forge  bool
+	}{
+		{"signed with an unpublished key", nil, true},
+		{"wrong issuer", map[string]any{"iss": "https://attacker.example"}, false},
+		{"wrong audience", map[string]any{"aud": "other-client"}, false},
+		{"audience of several clients without azp", map[string]any{"aud": []string{"test-client", "other-client"}}, false},
+		{"nonce mismatch", map[string]any{"nonce": "forged"}, false},
+		{"missing nonce", map[string]any{"nonce": ""}, false},
+		{"expired", map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}, false},
+		{"issued in the future", map[string]any{"iat": time.Now().Add(time.Hour).Unix()}, false},
+		{"missing subject", map[string]any{"sub": ""}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, store := setupOIDCTest(t)
+			if tt.forge {
+				key, err := oidctest.GenerateKey()
+				if err != nil {
+					t.Fatal(err)
+				}
+				idp.Signer = key
+			}
+
+			claims := verifiedIdentity("sub-1", "user@example.com")
+			for name, value := range tt.claims {
+				claims[name] = value
+			}
+
+			_, err := oidcLogin(t, idp, claims)
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("FinishOIDCLogin() error = %v, want %v", err, oidc.ErrInvalidIDToken)
+			}
+			if len(store.users) != 0 || len(store.identities) != 0 {
+				t.Fatal("a user was created for an invalid token")
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRejectsInvalidState(t *testing.T) {
+	idp, _ := setupOIDCTest(t)
+	ctx := context.Background()
+
+	authURL, browserKey, err := StartOIDCLogin(ctx, testProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := idp.Authorize(authURL, verifiedIdentity("sub-1", "user@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FinishOIDCLogin(ctx, testProvider, code, "unknown-state", browserKey); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("unknown state: error = %v, want %v", err, ErrInvalidOIDCState)
+	}
+
+	if _, err := FinishOIDCLogin(ctx, testProvider, code, state, browserKey); err != nil {
+		t.Fatalf("FinishOIDCLogin() error = %v", err)
+	}
+	if _, err := FinishOIDCLogin(ctx, testProvider, code, state, browserKey); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("reused state: error = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+func TestOIDCLoginRejectsStateOfAnotherProvider(t *testing.T) {
+	idp, _ := setupOIDCTest(t)
+	ctx := context.Background()
+	oidc.RegisterProvider(oidc.NewProvider("other", idp.Issuer(), idp.ClientID, "secret", "http://localhost/callback", []string{"openid"}))
+
+	authURL, browserKey, err := StartOIDCLogin(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := idp.Authorize(authURL, verifiedIdentity("sub-1", "user@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FinishOIDCLogin(ctx, testProvider, code, state, browserKey); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("FinishOIDCLogin() error = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+// login CSRF, the attacker's code and state completed in the victim's browser
+func TestOIDCLoginRejectsStateOfAnotherBrowser(t *testing.T) {
+	idp, store := setupOIDCTest(t)
+	ctx := context.Background()
+
+	authURL, browserKey, err := StartOIDCLogin(ctx, testProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, err := idp.Authorize(authURL, verifiedIdentity("sub-1", "attacker@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, victimKey, err := StartOIDCLogin(ctx, testProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", victimKey} {
+		if _, err := FinishOIDCLogin(ctx, testProvider, code, state, key); !errors.Is(err, ErrInvalidOIDCState) {
+			t.Fatalf("browser key %q: error = %v, want %v", key, err, ErrInvalidOIDCState)
+		}
+	}
+	if len(store.users) != 0 {
+		t.Fatal("a user was created from another browser")
+	}
+
+	// the state is still usable by the browser that started the login
+	if _, err := FinishOIDCLogin(ctx, testProvider, code, state, browserKey); err != nil {
+		t.Fatalf("FinishOIDCLogin() error = %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"backend/main/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidOneTimeToken = errors.New("invalid or expired token")
+
+// generates a signed single-use token bound to the purpose, only its hash should be stored
+func GenerateOneTimeToken(purpose string) (string, string) {
+	randomBytes := make([]byte, 32)
+	rand.Read(randomBytes)
+
+	raw := base64.RawURLEncoding.EncodeToString(randomBytes)
+	token := raw + "." + signHMAC(purpose+"."+raw, config.JWT_SECRET)
+
+	return token, HashToken(token)
+}
+
+// checks the signature of a one-time token and returns the hash to look it up by
+func VerifyOneTimeToken(purpose string, token string) (string, error) {
+	raw, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidOneTimeToken
+	}
+
+	expected := signHMAC(purpose+"."+raw, config.JWT_SECRET)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", ErrInvalidOneTimeToken
+	}
+
+	return HashToken(token), nil
+}
+
+// sha256 digest of a token in hex
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"backend/core/mailer"
+	"backend/core/passwords"
+	"backend/core/repositories"
+	"backend/main/config"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const passwordResetTTL = time.Hour
+
+// emails a reset link if the account exists, unknown emails are silently ignored
+func RequestPasswordReset(email string) error {
+	userID, err := repositories.SelectUserIDByEmail(email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if err := repositories.InvalidateOneTimeTokens(userID, repositories.PurposePasswordReset); err != nil {
+		return err
+	}
+
+	token, tokenHash := GenerateOneTimeToken(repositories.PurposePasswordReset)
+	expiresAt := time.Now().Add(passwordResetTTL)
+
+	err = repositories.SaveOneTimeToken(userID, repositories.PurposePasswordReset, tokenHash, email, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.APP_URL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Someone requested a password reset for your account. Open the link below to choose a new password:\n\n%s\n\n"+
+			"The link expires in 1 hour. If it wasn't you, ignore this email.",
+		link,
+	)
+
+	return mailer.Send(email, "Reset your password", body)
+}
+
+// sets a new password and signs the user out everywhere. The password is checked against the
+// policy here since the user is known only from the token, a *passwords.PolicyError is returned
+// without using up the token
+func ResetPassword(token string, password string) error {
+	tokenHash, err := VerifyOneTimeToken(repositories.PurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	userID, email, err := repositories.SelectOneTimeToken(repositories.PurposePasswordReset, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidOneTimeToken
+		}
+		return err
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return err
+	}
+	// the link was sent to an address the account no longer uses
+	if user.Email != email {
+		return ErrInvalidOneTimeToken
+	}
+
+	if err := passwords.Default.Check(password, user.Email, user.FullName); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = repositories.ResetPassword(tokenHash, userID, hashedPassword)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidOneTimeToken
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"slices"
+)
+
+const (
+	VisibilityPublic  = "public"  // any signed in user
+	VisibilityMatches = "matches" // users with an accepted match request
+	VisibilityPrivate = "private" // nobody else
+)
+
+var ProfileVisibilities = []string{VisibilityPublic, VisibilityMatches, VisibilityPrivate}
+
+func IsValidProfileVisibility(visibility string) bool {
+	return slices.Contains(ProfileVisibilities, visibility)
+}
+
+// tells whether the viewer may see the profile, blocks work both ways and banned users are hidden.
+// Returns pgx.ErrNoRows if the user doesn't exist
+func CanViewProfile(viewerID string, userID string) (bool, error) {
+	if viewerID == userID {
+		return true, nil
+	}
+
+	access, err := repositories.SelectProfileAccess(viewerID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if access.Banned || access.Blocked {
+		return false, nil
+	}
+
+	switch access.Visibility {
+	case VisibilityPublic:
+		return true, nil
+	case VisibilityMatches:
+		return access.Matched, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"sync"
+	"time"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// permissions checked by RequirePermission, granted to roles in role_permissions
+const (
+	PermissionLockoutsRead     = "lockouts:read"
+	PermissionUsersManageRoles = "users:manage_roles"
+	PermissionUsersBan         = "users:ban"
+)
+
+// role permissions are cached and reloaded from the database after this time
+const permissionsTTL = time.Minute
+
+var permissionsCache struct {
+	mu       sync.RWMutex
+	roles    map[string]map[string]bool
+	loadedAt time.Time
+}
+
+func RoleHasPermission(role string, permission string) (bool, error) {
+	permissionsCache.mu.RLock()
+	fresh := time.Since(permissionsCache.loadedAt) < permissionsTTL
+	granted := permissionsCache.roles[role][permission]
+	permissionsCache.mu.RUnlock()
+
+	if fresh {
+		return granted, nil
+	}
+
+	if err := LoadPermissions(); err != nil {
+		return false, err
+	}
+
+	permissionsCache.mu.RLock()
+	defer permissionsCache.mu.RUnlock()
+	return permissionsCache.roles[role][permission], nil
+}
+
+func RoleExists(role string) (bool, error) {
+	if _, err := RoleHasPermission(role, ""); err != nil {
+		return false, err
+	}
+
+	permissionsCache.mu.RLock()
+	defer permissionsCache.mu.RUnlock()
+	_, ok := permissionsCache.roles[role]
+	return ok, nil
+}
+
+func LoadPermissions() error {
+	rows, err := repositories.SelectRolePermissions()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	roles := make(map[string]map[string]bool)
+	for rows.Next() {
+		var role string
+		var permission *string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return err
+		}
+
+		if roles[role] == nil {
+			roles[role] = make(map[string]bool)
+		}
+		if permission != nil {
+			roles[role][*permission] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	permissionsCache.mu.Lock()
+	permissionsCache.roles = roles
+	permissionsCache.loadedAt = time.Now()
+	permissionsCache.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package services
+
+import "strings"
+
+// builds a human readable device label from the user agent when the client didn't send one
+func DeviceLabel(device string, userAgent string) string {
+	if device = strings.TrimSpace(device); device != "" {
+		// cut on a rune boundary, sessions only store valid text
+		if runes := []rune(device); len(runes) > 64 {
+			device = string(runes[:64])
+		}
+		return device
+	}
+
+	ua := strings.ToLower(userAgent)
+	var platform string
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	default:
+		return "Unknown device"
+	}
+
+	switch {
+	case strings.Contains(ua, "edg/"):
+		return "Edge on " + platform
+	case strings.Contains(ua, "chrome/"):
+		return "Chrome on " + platform
+	case strings.Contains(ua, "firefox/"):
+		return "Firefox on " + platform
+	case strings.Contains(ua, "safari/"):
+		return "Safari on " + platform
+	}
+	return platform
+}
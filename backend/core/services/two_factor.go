@@ -0,0 +1,185 @@
+package services
+
+import (
+	"backend/core/repositories"
+	"backend/core/tokens"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorChallengeAudience = "language-exchange-2fa"
+	twoFactorChallengeTTL      = 5 * time.Minute
+	recoveryCodesCount         = 10
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotSetUp         = errors.New("two-factor authentication is not set up")
+	ErrInvalidTwoFactorCode      = errors.New("invalid two-factor code")
+	ErrInvalidTwoFactorChallenge = errors.New("two-factor challenge is invalid, expired or already used")
+)
+
+// creates a new pending secret, 2FA starts being required only after EnableTwoFactor
+func SetupTwoFactor(userID string) (string, string, error) {
+	_, enabled, err := repositories.SelectTwoFactorState(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrTwoFactorAlreadyEnabled
+	}
+
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret := GenerateTOTPSecret()
+	if err := repositories.SetPendingTOTPSecret(userID, secret); err != nil {
+		return "", "", err
+	}
+
+	return secret, TOTPURI(secret, user.Email), nil
+}
+
+// confirms the pending secret with a code and returns freshly generated recovery codes,
+// they are shown only once since just their hashes are stored
+func EnableTwoFactor(userID string, code string) ([]string, error) {
+	secret, enabled, err := repositories.SelectTwoFactorState(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	step, ok := ValidateTOTP(secret, code)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		codes[i] = generateRecoveryCode()
+		hashes[i] = HashToken(codes[i])
+	}
+
+	if err := repositories.EnableTwoFactor(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func IsTwoFactorEnabled(userID string) (bool, error) {
+	_, enabled, err := repositories.SelectTwoFactorState(userID)
+	return enabled, err
+}
+
+// checks either a totp code or a recovery code, both can be used only once
+func VerifySecondFactor(userID string, code string, recoveryCode string) error {
+	if recoveryCode != "" {
+		used, err := repositories.ConsumeRecoveryCode(userID, HashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	secret, enabled, err := repositories.SelectTwoFactorState(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotSetUp
+	}
+
+	step, ok := ValidateTOTP(secret, code)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := repositories.UseTOTPStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// short-lived token proving the password step of the login was passed, its jti is stored
+// so it can open only one session
+func GenerateTwoFactorChallenge(userID string) (string, error) {
+	claims := tokens.NewClaims(userID, twoFactorChallengeAudience, twoFactorChallengeTTL)
+	if err := repositories.SaveTwoFactorChallenge(claims.ID, userID, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return "", err
+	}
+	return tokens.Default.Sign(claims)
+}
+
+// returns the user and the jti of a challenge that wasn't used yet,
+// ErrInvalidTwoFactorChallenge is returned for forged, expired and used ones
+func ParseTwoFactorChallenge(challenge string) (string, string, error) {
+	opts := tokens.DefaultValidationOptions()
+	opts.Audience = twoFactorChallengeAudience
+
+	claims, err := tokens.Default.Parse(challenge, opts)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidTwoFactorChallenge, err)
+	}
+
+	pending, err := repositories.IsTwoFactorChallengePending(claims.ID, claims.Subject)
+	if err != nil {
+		return "", "", err
+	}
+	if !pending {
+		return "", "", ErrInvalidTwoFactorChallenge
+	}
+	return claims.Subject, claims.ID, nil
+}
+
+// uses up the challenge after the second factor was verified, only one of concurrent
+// verifications of the same challenge succeeds
+func ConsumeTwoFactorChallenge(userID string, jti string) error {
+	consumed, err := repositories.ConsumeTwoFactorChallenge(jti, userID)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidTwoFactorChallenge
+	}
+	return nil
+}
+
+// 10 random characters formatted as xxxxx-xxxxx
+func generateRecoveryCode() string {
+	raw := make([]byte, 10)
+	rand.Read(raw)
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+	return code[:5] + "-" + code[5:]
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
@@ -2,42 +2,58 @@ package services
 
 import (
 	"backend/core/db"
+	"backend/core/passwords"
+	"backend/core/repositories"
+	"backend/core/tokens"
 	"backend/main/config"
 	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"strings"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
-type Payload struct {
-	Sub string `json:"sub"` // id
-	Exp int64  `json:"exp"` // expiration time
-	Iat int64  `json:"iat"` // issued at
-}
+// signs an access token and records its jti so it can be revoked before it expires.
+// The role is read from the database, so role changes apply from the next refresh
+func GenerateAccessToken(userID string, sessionID string) (string, error) {
+	role, err := repositories.SelectUserRole(userID)
+	if err != nil {
+		return "", err
+	}
 
-func GenerateAccessToken(userID string) string {
-	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
-	expiry := int64(600) // 10 minutes
+	claims := tokens.NewClaims(userID, tokens.DefaultAudience, config.ACCESS_TOKEN_TTL)
+	claims.SessionID = sessionID
+	claims.Role = role
 
-	payloadStruct := Payload{
-		Sub: userID,
-		Exp: time.Now().Unix() + expiry,
-		Iat: time.Now().Unix(),
+	accessToken, err := tokens.Default.Sign(claims)
+	if err != nil {
+		return "", err
+	}
+
+	err = repositories.SaveAccessToken(userID, sessionID, claims.ID, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return "", err
 	}
-	payloadBytes, _ := json.Marshal(payloadStruct)
-	payload := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	return accessToken, nil
+}
 
-	signature := signHMAC(header+"."+payload, config.JWT_SECRET)
+// lifetimes in seconds, returned to clients as expires_in and refresh_expires_in
+func TokenExpiresIn() (int, int) {
+	return int(config.ACCESS_TOKEN_TTL.Seconds()), int(config.REFRESH_TOKEN_TTL.Seconds())
+}
 
-	token := header + "." + payload + "." + signature
-	return token
+// generates a refresh token for the session and saves its digest
+func IssueRefreshToken(userID string, sessionID string) (string, error) {
+	refreshToken := GenerateRefreshToken(userID)
+
+	err := repositories.SaveRefreshToken(userID, HashToken(refreshToken), sessionID, time.Now().Add(config.REFRESH_TOKEN_TTL))
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
 }
 
 func GenerateRefreshToken(userID string) string {
@@ -51,32 +67,23 @@ func GenerateRefreshToken(userID string) string {
 	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 }
 
-// gets id from access token payload, validated token must be passed
-func ExtractID(token string) (string, error) {
-	parts := strings.Split(token, ".")
-	if len(parts) == 3 {
-		if ValidateAccessToken(parts) {
-			payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
-			if err != nil {
-				return "", fmt.Errorf("failed to decode payload")
-			}
-
-			var payloadData Payload
-			err = json.Unmarshal(payloadBytes, &payloadData)
-			if err != nil {
-				return "", fmt.Errorf("failed to unmarshal payload")
-			}
-
-			return payloadData.Sub, nil
-		}
+// verifies the access token and validates its claims, errors come from the tokens package
+// or are ErrAccessTokenRevoked for tokens on the denylist
+func ParseAccessToken(token string) (*tokens.Claims, error) {
+	claims, err := tokens.Default.Parse(token, tokens.DefaultValidationOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	if IsAccessTokenRevoked(claims.ID) {
+		return nil, ErrAccessTokenRevoked
 	}
-	return "", nil
+	return claims, nil
 }
 
 func ValidateToken(token string) bool {
-	parts := strings.Split(token, ".")
-	if len(parts) == 3 {
-		return ValidateAccessToken(parts)
+	if strings.Count(token, ".") == 2 {
+		return ValidateAccessToken(token)
 	} else {
 		return ValidateRefreshToken(token)
 	}
@@ -87,8 +94,8 @@ func ValidateRefreshToken(token string) bool {
 	var revoked bool
 
 	err := db.DB.QueryRow(context.Background(), `
-		SELECT expires_at, revoked FROM refresh_tokens WHERE token = $1
-	`, token).Scan(&expTime, &revoked)
+		SELECT expires_at, revoked FROM refresh_tokens WHERE token_hash = $1
+	`, HashToken(token)).Scan(&expTime, &revoked)
 
 	if err != nil || revoked || time.Now().After(expTime) {
 		return false
@@ -97,46 +104,37 @@ func ValidateRefreshToken(token string) bool {
 	return true
 }
 
-func ValidateAccessToken(token_parts []string) bool {
-	header, payload, receivedSig := token_parts[0], token_parts[1], token_parts[2]
-	expectedSig := signHMAC(header+"."+payload, config.JWT_SECRET)
-
-	if receivedSig != expectedSig {
-		return false //, "Invalid signature"
-	}
-
-	return CheckAccessTokenRelevance(payload)
+func ValidateAccessToken(token string) bool {
+	_, err := ParseAccessToken(token)
+	return err == nil
 }
 
-func CheckAccessTokenRelevance(payload string) bool {
-	payloadBytes, _ := base64.RawURLEncoding.DecodeString(payload)
-	var payloadData Payload
-	json.Unmarshal(payloadBytes, &payloadData)
+// rotates the refresh token and returns a new access/refresh pair. errCode is 1 for an invalid token,
+// 2 when reuse of a rotated token was detected and 3 if the access token couldn't be signed
+func GetNewAccessToken(token string) (int, string, string) {
+	tokenHash := HashToken(token)
 
-	if time.Now().Unix() > payloadData.Exp {
-		return false // "Token expired"
+	userID, err := repositories.SelectRefreshTokenOwner(tokenHash)
+	if err != nil {
+		return 1, "", ""
 	}
 
-	return true // "Valid token"
-}
-
-// returns a new access token if the recharge token is OK, otherwise an error
-func GetNewAccessToken(token string) (int, string) {
-	var userID string
-	var expTime time.Time
-	var revoked bool
+	newRefreshToken := GenerateRefreshToken(userID)
 
-	err := db.DB.QueryRow(context.Background(), `
-		SELECT user_id, expires_at, revoked 
-		FROM refresh_tokens 
-		WHERE token = $1
-	`, token).Scan(&userID, &expTime, &revoked)
+	sessionID, err := repositories.RotateRefreshToken(tokenHash, HashToken(newRefreshToken), time.Now().Add(config.REFRESH_TOKEN_TTL))
+	if err != nil {
+		if errors.Is(err, repositories.ErrRefreshTokenReused) {
+			return 2, "", ""
+		}
+		return 1, "", ""
+	}
 
-	if err != nil || revoked || time.Now().After(expTime) {
-		return 1, ""
+	accessToken, err := GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		return 3, "", ""
 	}
 
-	return 0, GenerateAccessToken(userID)
+	return 0, accessToken, newRefreshToken
 }
 
 // signature generation
@@ -147,15 +145,11 @@ func signHMAC(data string, secret string) string {
 	return base64.RawURLEncoding.EncodeToString(signature)
 }
 
+// hashes with the configured algorithm, see passwords.Hasher for the format
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+	return passwords.DefaultHasher.Hash(password)
 }
 
 func CheckPassword(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+	return passwords.DefaultHasher.Verify(password, hashedPassword)
 }
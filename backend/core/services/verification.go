@@ -0,0 +1,78 @@
+package services
+
+import (
+	"backend/core/mailer"
+	"backend/core/repositories"
+	"backend/main/config"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+var ErrEmailAlreadyVerified = errors.New("email is already verified")
+
+// issues a new verification token, previous ones stop working
+func SendVerificationEmail(userID string, email string) error {
+	if err := repositories.InvalidateOneTimeTokens(userID, repositories.PurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, tokenHash := GenerateOneTimeToken(repositories.PurposeEmailVerification)
+	expiresAt := time.Now().Add(emailVerificationTTL)
+
+	err := repositories.SaveOneTimeToken(userID, repositories.PurposeEmailVerification, tokenHash, email, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.APP_URL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Confirm your email address by opening the link below:\n\n%s\n\nThe link expires in 24 hours.",
+		link,
+	)
+
+	return mailer.Send(email, "Confirm your email address", body)
+}
+
+func VerifyEmail(token string) error {
+	tokenHash, err := VerifyOneTimeToken(repositories.PurposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	userID, email, err := repositories.ConsumeOneTimeToken(repositories.PurposeEmailVerification, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidOneTimeToken
+		}
+		return err
+	}
+
+	verified, err := repositories.MarkEmailVerified(userID, email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return ErrInvalidOneTimeToken
+	}
+
+	return nil
+}
+
+func ResendVerificationEmail(userID string) error {
+	user, err := repositories.SelectUserInfo(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Verified {
+		return ErrEmailAlreadyVerified
+	}
+
+	return SendVerificationEmail(userID, user.Email)
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 compatible store using path-style requests, so it also works with stand-ins like MinIO
+type S3Store struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	hash := sha256.Sum256(data)
+	s.signer().SignRequest(req, hex.EncodeToString(hash[:]), time.Now())
+
+	return s.do(req)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	s.signer().SignRequest(req, emptyPayloadHash, time.Now())
+
+	return s.do(req)
+}
+
+// presigned GET URL. The signing time is rounded down to the hour, so the URL stays the same
+// for a while and can be cached
+func (s *S3Store) URL(key string, expiresAt time.Time) (string, error) {
+	signedAt := time.Now().Truncate(time.Hour)
+
+	expires := expiresAt.Sub(signedAt)
+	// presigned URLs can't be valid for more than 7 days
+	if expires > 7*24*time.Hour {
+		expires = 7 * 24 * time.Hour
+	}
+
+	return s.signer().PresignGet(s.objectURL(key), expires, signedAt), nil
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u, _ := url.Parse(s.Endpoint)
+	// JoinPath keeps an empty path relative, the signed path needs its leading slash
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.JoinPath(s.Bucket, key)
+}
+
+func (s *S3Store) signer() sigV4Signer {
+	return sigV4Signer{AccessKey: s.AccessKey, SecretKey: s.SecretKey, Region: s.Region, Service: "s3"}
+}
+
+func (s *S3Store) do(req *http.Request) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, body)
+	}
+	return nil
+}
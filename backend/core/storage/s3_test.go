@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// minimal S3 stand-in keeping objects in memory. Every request has to carry a valid
+// signature, recomputed here with the same credentials
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+	signer sigV4Signer
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	fail    bool // answers every request with a 500
+}
+
+type fakeObject struct {
+	contentType string
+	data        []byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Store) {
+	fake := &fakeS3{
+		t:       t,
+		bucket:  "avatars-bucket",
+		signer:  sigV4Signer{AccessKey: "test-access", SecretKey: "test-secret", Region: "eu-central-1", Service: "s3"},
+		objects: make(map[string]fakeObject),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store := &S3Store{
+		Endpoint:  server.URL + "/",
+		Region:    fake.signer.Region,
+		Bucket:    fake.bucket,
+		AccessKey: fake.signer.AccessKey,
+		SecretKey: fake.signer.SecretKey,
+		Client:    server.Client(),
+	}
+	return fake, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.fail {
+		http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Has("X-Amz-Signature") {
+		if r.Method != http.MethodGet || !f.validPresigned(r) {
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+	} else if !f.validAuthorization(r) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hash := sha256.Sum256(body)
+		if hex.EncodeToString(hash[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = fakeObject{contentType: r.Header.Get("Content-Type"), data: body}
+	case http.MethodDelete:
+		// S3 answers 204 for missing keys too
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.data)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) validAuthorization(r *http.Request) bool {
+	signedAt, err := time.Parse(sigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	expected, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		f.t.Error(err)
+		return false
+	}
+	for name, values := range r.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			expected.Header[name] = values
+		}
+	}
+	f.signer.SignRequest(expected, r.Header.Get("X-Amz-Content-Sha256"), signedAt)
+
+	return r.Header.Get("Authorization") == expected.Header.Get("Authorization")
+}
+
+func (f *fakeS3) validPresigned(r *http.Request) bool {
+	query := r.URL.Query()
+	signedAt, err := time.Parse(sigV4TimeFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || seconds > 7*24*60*60 || time.Now().After(signedAt.Add(time.Duration(seconds)*time.Second)) {
+		return false
+	}
+
+	unsigned := &url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+	presigned, err := url.Parse(f.signer.PresignGet(unsigned, time.Duration(seconds)*time.Second, signedAt))
+	if err != nil {
+		return false
+	}
+	return presigned.Query().Get("X-Amz-Signature") == query.Get("X-Amz-Signature")
+}
+
+func (f *fakeS3) object(key string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[key]
+	return object, ok
+}
+
+func TestS3StorePutAndDelete(t *testing.T) {
+	fake, store := newFakeS3(t)
+	ctx := context.Background()
+	key := "avatars/42/abc_256.jpg"
+	data := []byte("\xff\xd8 not really a jpeg")
+
+	if err := store.Put(ctx, key, "image/jpeg", data); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	object, ok := fake.object(key)
+	if !ok || object.contentType != "image/jpeg" || !bytes.Equal(object.data, data) {
+		t.Fatalf("stored object = %+v, %v", object, ok)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok := fake.object(key); ok {
+		t.Fatal("object still exists after Delete()")
+	}
+}
+
+func TestS3StoreRejectsWrongCredentials(t *testing.T) {
+	_, store := newFakeS3(t)
+	store.SecretKey = "wrong-secret"
+
+	err := store.Put(context.Background(), "avatars/1/a_64.jpg", "image/jpeg", []byte("data"))
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Put() error = %v, want a 403", err)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	fake, store := newFakeS3(t)
+	ctx := context.Background()
+
+	store.Bucket = "missing-bucket"
+	if err := store.Put(ctx, "a.jpg", "image/jpeg", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Put() to a missing bucket: error = %v, want %v", err, ErrNotFound)
+	}
+
+	store.Bucket = fake.bucket
+	fake.fail = true
+	err := store.Delete(ctx, "a.jpg")
+	if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "InternalError") {
+		t.Fatalf("Delete() error = %v, want the 500 with its body", err)
+	}
+}
+
+func TestS3StoreURL(t *testing.T) {
+	_, store := newFakeS3(t)
+	key := "avatars/42/abc_64.jpg"
+	data := []byte("thumbnail")
+
+	if err := store.Put(context.Background(), key, "image/jpeg", data); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	expiresAt := time.Now().Add(2 * time.Hour)
+	signedURL, err := store.URL(key, expiresAt)
+	if err != nil {
+		t.Fatalf("URL() error = %v", err)
+	}
+
+	resp, err := store.Client.Get(signedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("GET %s = %d %q, want the object", signedURL, resp.StatusCode, body)
+	}
+
+	// signed at the start of the hour so the URL can be cached
+	again, err := store.URL(key, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != signedURL && time.Now().Minute() != 0 {
+		t.Fatalf("URL() changed within the hour:\n%s\n%s", signedURL, again)
+	}
+
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedAt, err := time.Parse(sigV4TimeFormat, parsed.Query().Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seconds, _ := strconv.Atoi(parsed.Query().Get("X-Amz-Expires"))
+	if validUntil := signedAt.Add(time.Duration(seconds) * time.Second); validUntil.Before(expiresAt.Truncate(time.Second)) {
+		t.Fatalf("URL is valid until %v, want at least %v", validUntil, expiresAt)
+	}
+
+	tampered := strings.Replace(signedURL, "abc_64", "abc_256", 1)
+	resp, err = store.Client.Get(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("GET of a tampered URL = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestS3StoreURLExpiryIsCapped(t *testing.T) {
+	_, store := newFakeS3(t)
+
+	signedURL, err := store.URL("a.jpg", time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Query().Get("X-Amz-Expires"); got != "604800" {
+		t.Fatalf("X-Amz-Expires = %s, want the 7 day maximum", got)
+	}
+}
+
+func TestS3StoreObjectURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"http://localhost:9000", "/bucket/avatars/1/a_64.jpg"},
+		{"http://localhost:9000/", "/bucket/avatars/1/a_64.jpg"},
+		{"https://storage.example.com/s3", "/s3/bucket/avatars/1/a_64.jpg"},
+	}
+
+	for _, tt := range tests {
+		store := &S3Store{Endpoint: tt.endpoint, Bucket: "bucket"}
+		// the presigned URL is signed from this URL without being parsed again
+		if got := store.objectURL("avatars/1/a_64.jpg").Path; got != tt.want {
+			t.Fatalf("%s: objectURL() path = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
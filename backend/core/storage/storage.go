@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"backend/main/config"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// stores binary objects like avatars under slash separated keys
+type BlobStore interface {
+	Put(ctx context.Context, key string, contentType string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	// a URL the object can be downloaded from until at least expiresAt
+	URL(key string, expiresAt time.Time) (string, error)
+}
+
+var Default BlobStore
+
+// selects the store implementation according to the config
+func InitStorage() {
+	switch config.STORAGE {
+	case "local":
+		store, err := NewLocalStore(config.STORAGE_LOCAL_DIR, config.API_URL+"/media", []byte(config.JWT_SECRET))
+		if err != nil {
+			log.Fatalf("Failed to prepare local storage: %v", err)
+		}
+		Default = store
+	case "s3":
+		Default = &S3Store{
+			Endpoint:  config.S3_ENDPOINT,
+			Region:    config.S3_REGION,
+			Bucket:    config.S3_BUCKET,
+			AccessKey: config.S3_ACCESS_KEY,
+			SecretKey: config.S3_SECRET_KEY,
+		}
+	default:
+		log.Fatalf("Unknown STORAGE %q, expected local or s3", config.STORAGE)
+	}
+}
+
+// expiry of URLs valid for at least ttl, rounded so repeated requests get the same
+// URL and browsers can cache the object
+func URLExpiry(ttl time.Duration) time.Time {
+	return time.Now().Truncate(ttl).Add(2 * ttl)
+}
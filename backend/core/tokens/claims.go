@@ -0,0 +1,146 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrExpired         = errors.New("token is expired")
+	ErrNotYetValid     = errors.New("token is not valid yet")
+	ErrInvalidIssuer   = errors.New("token issuer is invalid")
+	ErrInvalidAudience = errors.New("token audience is invalid")
+	ErrMissingClaims   = errors.New("token is missing required claims")
+)
+
+// issuer of our tokens, audience of access tokens and the allowed clock skew, InitKeyring
+// replaces the issuer and audience with the configured ones
+var (
+	DefaultIssuer   = "language-exchange"
+	DefaultAudience = "language-exchange-api"
+	DefaultLeeway   = 30 * time.Second
+)
+
+// registered claims plus the session id and role
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+	ID        string   `json:"jti"`
+	SessionID string   `json:"sid,omitempty"`
+	Role      string   `json:"role,omitempty"`
+}
+
+// "aud" can be either a single string or an array of strings
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+type ValidationOptions struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	Now      func() time.Time
+}
+
+// options used for access tokens issued by this service
+func DefaultValidationOptions() ValidationOptions {
+	return ValidationOptions{
+		Issuer:   DefaultIssuer,
+		Audience: DefaultAudience,
+		Leeway:   DefaultLeeway,
+		Now:      time.Now,
+	}
+}
+
+// claims of a fresh token valid for ttl, jti is random
+func NewClaims(subject string, audience string, ttl time.Duration) Claims {
+	now := time.Now().Unix()
+
+	return Claims{
+		Issuer:    DefaultIssuer,
+		Subject:   subject,
+		Audience:  Audience{audience},
+		ExpiresAt: now + int64(ttl/time.Second),
+		NotBefore: now,
+		IssuedAt:  now,
+		ID:        rand.Text(),
+	}
+}
+
+// verifies the signature and validates the claims, errors of this package are returned
+// so callers can tell expired tokens apart from malformed or forged ones
+func (k *Keyring) Parse(token string, opts ValidationOptions) (*Claims, error) {
+	payload, err := k.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := claims.Validate(opts); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (c *Claims) Validate(opts ValidationOptions) error {
+	if c.Subject == "" || c.ExpiresAt == 0 || c.ID == "" {
+		return ErrMissingClaims
+	}
+
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	current := now().Unix()
+	leeway := int64(opts.Leeway / time.Second)
+
+	if current > c.ExpiresAt+leeway {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && current < c.NotBefore-leeway {
+		return ErrNotYetValid
+	}
+	if c.IssuedAt != 0 && current < c.IssuedAt-leeway {
+		return ErrNotYetValid
+	}
+
+	if opts.Issuer != "" && c.Issuer != opts.Issuer {
+		return ErrInvalidIssuer
+	}
+	if opts.Audience != "" && !slices.Contains(c.Audience, opts.Audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
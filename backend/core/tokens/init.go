@@ -0,0 +1,33 @@
+package tokens
+
+import (
+	"backend/main/config"
+	"log"
+)
+
+// loads the signing keys from JWT_KEYS_DIR, falls back to a temporary key only when JWT_DEV_KEY is set.
+// Issuer and audience come from JWT_ISSUER and JWT_AUDIENCE
+func InitKeyring() {
+	DefaultIssuer = config.JWT_ISSUER
+	DefaultAudience = config.JWT_AUDIENCE
+
+	if config.JWT_KEYS_DIR == "" {
+		if !config.JWT_DEV_KEY {
+			log.Fatal("JWT_KEYS_DIR not setted in the environment, set JWT_DEV_KEY=true to use a temporary key in development")
+		}
+		keyring, err := NewEphemeralKeyring()
+		if err != nil {
+			log.Fatalf("Failed to generate signing key: %v", err)
+		}
+		log.Println("JWT_KEYS_DIR not setted, using a temporary signing key")
+		Default = keyring
+		return
+	}
+
+	keyring, err := LoadKeyring(config.JWT_KEYS_DIR, config.JWT_ACTIVE_KID)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	log.Printf("Loaded %d signing keys, active kid %q", len(keyring.keys), keyring.active.ID)
+	Default = keyring
+}
@@ -0,0 +1,123 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid"`
+}
+
+var (
+	ErrMalformed            = errors.New("token is malformed")
+	ErrUnsupportedAlgorithm = errors.New("token algorithm is not supported")
+	ErrUnknownKey           = errors.New("token is signed with an unknown key")
+	ErrBadSignature         = errors.New("token signature is invalid")
+)
+
+var encoding = base64.RawURLEncoding.Strict()
+
+// serializes the claims and signs them with the active key
+func (k *Keyring) Sign(claims any) (string, error) {
+	key := k.active
+
+	headerBytes, err := json.Marshal(header{Alg: key.Algorithm, Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payloadBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(headerBytes) + "." + encoding.EncodeToString(payloadBytes)
+
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// checks the signature with the key named by kid and returns the raw payload,
+// claims are not validated
+func (k *Keyring) Verify(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	headerBytes, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := json.Unmarshal(headerBytes, &h); err != nil {
+		return nil, ErrMalformed
+	}
+	if h.Typ != "" && !strings.EqualFold(h.Typ, "JWT") {
+		return nil, ErrMalformed
+	}
+
+	if h.Alg != AlgEdDSA && h.Alg != AlgRS256 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	key, ok := k.keys[h.Kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// the algorithm is dictated by the key, never by the token
+	if h.Alg != key.Algorithm {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrBadSignature
+	}
+
+	return payload, nil
+}
+
+func (key *Key) sign(data []byte) ([]byte, error) {
+	switch key.Algorithm {
+	case AlgEdDSA:
+		return key.private.Sign(rand.Reader, data, crypto.Hash(0))
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		return key.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// both checks run in constant time with respect to the signature
+func (key *Key) verify(data []byte, signature []byte) bool {
+	switch public := key.public.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_750_000_000, 0)
+
+type testKeys struct {
+	keyring *Keyring
+	ed      *Key
+	rsa     *Key
+}
+
+func newTestKeys(t testing.TB) testKeys {
+	t.Helper()
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed := &Key{ID: "ed", Algorithm: AlgEdDSA, private: edPrivate, public: edPublic}
+	rs := &Key{ID: "rsa", Algorithm: AlgRS256, private: rsaPrivate, public: &rsaPrivate.PublicKey}
+
+	return testKeys{
+		keyring: &Keyring{active: ed, keys: map[string]*Key{ed.ID: ed, rs.ID: rs}},
+		ed:      ed,
+		rsa:     rs,
+	}
+}
+
+func testOptions() ValidationOptions {
+	return ValidationOptions{
+		Issuer:   "test-issuer",
+		Audience: "test-audience",
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return testNow },
+	}
+}
+
+func testClaims() Claims {
+	now := testNow.Unix()
+	return Claims{
+		Issuer:    "test-issuer",
+		Subject:   "42",
+		Audience:  Audience{"test-audience"},
+		ExpiresAt: now + 600,
+		NotBefore: now,
+		IssuedAt:  now,
+		ID:        "jti",
+	}
+}
+
+func segment(t testing.TB, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoding.EncodeToString(data)
+}
+
+// token with an arbitrary header, signed by key or with an empty signature when key is nil
+func craftToken(t testing.TB, h map[string]any, claims any, key *Key) string {
+	t.Helper()
+	signingInput := segment(t, h) + "." + segment(t, claims)
+	if key == nil {
+		return signingInput + "."
+	}
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + encoding.EncodeToString(signature)
+}
+
+func TestParse(t *testing.T) {
+	keys := newTestKeys(t)
+
+	withClaims := func(edit func(c *Claims)) Claims {
+		c := testClaims()
+		edit(&c)
+		return c
+	}
+	signed := func(key *Key, claims any) string {
+		return craftToken(t, map[string]any{"alg": key.Algorithm, "typ": "JWT", "kid": key.ID}, claims, key)
+	}
+
+	// HS256 signed with the RSA public key, the classic algorithm confusion attack
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(keys.rsa.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublicDER})
+	hsInput := segment(t, map[string]any{"alg": "HS256", "typ": "JWT", "kid": "rsa"}) + "." + segment(t, testClaims())
+	mac := hmac.New(sha256.New, rsaPublicPEM)
+	mac.Write([]byte(hsInput))
+	hsToken := hsInput + "." + encoding.EncodeToString(mac.Sum(nil))
+
+	valid := signed(keys.ed, testClaims())
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid EdDSA", valid, nil},
+		{"valid RS256", signed(keys.rsa, testClaims()), nil},
+		{"expired within leeway", signed(keys.ed, withClaims(func(c *Claims) { c.ExpiresAt = testNow.Unix() - 10 })), nil},
+		{"audience array", signed(keys.ed, withClaims(func(c *Claims) { c.Audience = Audience{"other", "test-audience"} })), nil},
+
+		{"expired", signed(keys.ed, withClaims(func(c *Claims) { c.ExpiresAt = testNow.Unix() - 60 })), ErrExpired},
+		{"not yet valid", signed(keys.ed, withClaims(func(c *Claims) { c.NotBefore = testNow.Unix() + 60 })), ErrNotYetValid},
+		{"issued in the future", signed(keys.ed, withClaims(func(c *Claims) { c.IssuedAt = testNow.Unix() + 60 })), ErrNotYetValid},
+		{"wrong issuer", signed(keys.ed, withClaims(func(c *Claims) { c.Issuer = "someone-else" })), ErrInvalidIssuer},
+		{"wrong audience", signed(keys.ed, withClaims(func(c *Claims) { c.Audience = Audience{"other"} })), ErrInvalidAudience},
+		{"missing subject", signed(keys.ed, withClaims(func(c *Claims) { c.Subject = "" })), ErrMissingClaims},
+		{"missing expiry", signed(keys.ed, withClaims(func(c *Claims) { c.ExpiresAt = 0 })), ErrMissingClaims},
+		{"missing jti", signed(keys.ed, withClaims(func(c *Claims) { c.ID = "" })), ErrMissingClaims},
+
+		{"alg none", craftToken(t, map[string]any{"alg": "none", "kid": "ed"}, testClaims(), nil), ErrUnsupportedAlgorithm},
+		{"alg none without kid", craftToken(t, map[string]any{"alg": "none"}, testClaims(), nil), ErrUnsupportedAlgorithm},
+		{"HS256 with RSA public key", hsToken, ErrUnsupportedAlgorithm},
+		{"RS256 header on EdDSA key", craftToken(t, map[string]any{"alg": AlgRS256, "kid": "ed"}, testClaims(), keys.rsa), ErrUnsupportedAlgorithm},
+		{"EdDSA header on RSA key", craftToken(t, map[string]any{"alg": AlgEdDSA, "kid": "rsa"}, testClaims(), keys.ed), ErrUnsupportedAlgorithm},
+		{"unknown kid", craftToken(t, map[string]any{"alg": AlgEdDSA, "kid": "missing"}, testClaims(), keys.ed), ErrUnknownKey},
+		{"signed by another key", craftToken(t, map[string]any{"alg": AlgEdDSA, "kid": "ed"}, testClaims(), newTestKeys(t).ed), ErrBadSignature},
+		{"tampered payload", parts[0] + "." + segment(t, withClaims(func(c *Claims) { c.Subject = "1" })) + "." + parts[2], ErrBadSignature},
+		{"empty signature", parts[0] + "." + parts[1] + ".", ErrBadSignature},
+
+		{"empty", "", ErrMalformed},
+		{"two segments", parts[0] + "." + parts[1], ErrMalformed},
+		{"four segments", valid + ".", ErrMalformed},
+		{"header not base64", "!!." + parts[1] + "." + parts[2], ErrMalformed},
+		{"header padded base64", parts[0] + "=." + parts[1] + "." + parts[2], ErrMalformed},
+		{"header not JSON", encoding.EncodeToString([]byte("{")) + "." + parts[1] + "." + parts[2], ErrMalformed},
+		{"payload not base64", parts[0] + ".!!." + parts[2], ErrMalformed},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!", ErrMalformed},
+		{"payload not JSON", craftToken(t, map[string]any{"alg": AlgEdDSA, "kid": "ed"}, "not an object", keys.ed), ErrMalformed},
+		{"unexpected typ", craftToken(t, map[string]any{"alg": AlgEdDSA, "typ": "at+jwt", "kid": "ed"}, testClaims(), keys.ed), ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := keys.keyring.Parse(tt.token, testOptions())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && (claims == nil || claims.Subject == "") {
+				t.Fatalf("Parse() returned claims %+v", claims)
+			}
+			if tt.err != nil && claims != nil {
+				t.Fatalf("Parse() returned claims with error %v", err)
+			}
+		})
+	}
+}
+
+func TestSignParseRoundTrip(t *testing.T) {
+	keys := newTestKeys(t)
+
+	for _, key := range []*Key{keys.ed, keys.rsa} {
+		keyring := &Keyring{active: key, keys: keys.keyring.keys}
+
+		token, err := keyring.Sign(testClaims())
+		if err != nil {
+			t.Fatalf("%s: Sign() error = %v", key.Algorithm, err)
+		}
+		claims, err := keys.keyring.Parse(token, testOptions())
+		if err != nil {
+			t.Fatalf("%s: Parse() error = %v", key.Algorithm, err)
+		}
+		if claims.Subject != "42" || claims.ID != "jti" {
+			t.Fatalf("%s: Parse() claims = %+v", key.Algorithm, claims)
+		}
+	}
+}
+
+var typedErrors = []error{
+	ErrMalformed,
+	ErrUnsupportedAlgorithm,
+	ErrUnknownKey,
+	ErrBadSignature,
+	ErrExpired,
+	ErrNotYetValid,
+	ErrInvalidIssuer,
+	ErrInvalidAudience,
+	ErrMissingClaims,
+}
+
+func FuzzParse(f *testing.F) {
+	keys := newTestKeys(f)
+
+	valid := craftToken(f, map[string]any{"alg": AlgEdDSA, "typ": "JWT", "kid": "ed"}, testClaims(), keys.ed)
+	f.Add(valid)
+	f.Add(craftToken(f, map[string]any{"alg": AlgRS256, "kid": "rsa"}, testClaims(), keys.rsa))
+	f.Add(craftToken(f, map[string]any{"alg": "none"}, testClaims(), nil))
+	f.Add(craftToken(f, map[string]any{"alg": AlgEdDSA, "kid": "ed"}, map[string]any{"aud": 1, "exp": "soon"}, keys.ed))
+	f.Add("")
+	f.Add("..")
+	f.Add("a.b.c")
+	f.Add(valid + ".")
+
+	f.Fuzz(func(t *testing.T, token string) {
+		claims, err := keys.keyring.Parse(token, testOptions())
+		if err == nil {
+			if claims == nil {
+				t.Fatal("Parse() returned neither claims nor an error")
+			}
+			return
+		}
+
+		for _, typed := range typedErrors {
+			if errors.Is(err, typed) {
+				return
+			}
+		}
+		t.Fatalf("Parse() returned an untyped error: %v", err)
+	})
+}
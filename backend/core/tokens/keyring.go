@@ -0,0 +1,201 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+const minRSABits = 2048
+
+var errRSAKeyTooShort = fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+
+// signing or verification key, private is nil for keys kept only to verify old tokens
+type Key struct {
+	ID        string
+	Algorithm string
+	private   crypto.Signer
+	public    crypto.PublicKey
+}
+
+// set of verification keys with one active signing key.
+// To rotate keys add a new key, make it active and drop the old one once its tokens expired
+type Keyring struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+var Default *Keyring
+
+// loads every *.pem file of the directory, the file name without extension is used as kid.
+// Private keys (PKCS#8 Ed25519/RSA or PKCS#1 RSA) can sign, public keys (PKIX) only verify
+func LoadKeyring(dir string, activeKID string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	keyring := &Keyring{keys: make(map[string]*Key)}
+	var signers []*Key
+
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+		}
+
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+		}
+
+		keyring.keys[kid] = key
+		if key.private != nil {
+			signers = append(signers, key)
+		}
+	}
+
+	if activeKID == "" && len(signers) == 1 {
+		activeKID = signers[0].ID
+	}
+
+	active, ok := keyring.keys[activeKID]
+	if !ok || active.private == nil {
+		return nil, fmt.Errorf("no private key with kid %q found in %s", activeKID, dir)
+	}
+	keyring.active = active
+
+	return keyring, nil
+}
+
+// keyring with a freshly generated Ed25519 key, tokens don't survive a restart
+func NewEphemeralKeyring() (*Keyring, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	kidBytes := make([]byte, 8)
+	rand.Read(kidBytes)
+
+	key := &Key{
+		ID:        "ephemeral-" + base64.RawURLEncoding.EncodeToString(kidBytes),
+		Algorithm: AlgEdDSA,
+		private:   private,
+		public:    public,
+	}
+
+	return &Keyring{
+		active: key,
+		keys:   map[string]*Key{key.ID: key},
+	}, nil
+}
+
+func (k *Keyring) Active() *Key {
+	return k.active
+}
+
+func (k *Keyring) Key(kid string) (*Key, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// public part of every key in JWK format
+func (k *Keyring) JWKS() map[string]any {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		jwks = append(jwks, k.keys[kid].JWK())
+	}
+
+	return map[string]any{"keys": jwks}
+}
+
+func (key *Key) JWK() map[string]string {
+	jwk := map[string]string{
+		"kid": key.ID,
+		"alg": key.Algorithm,
+		"use": "sig",
+	}
+
+	switch public := key.public.(type) {
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	}
+
+	return jwk
+}
+
+func parseKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: kid}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Algorithm, key.private, key.public = AlgEdDSA, k, k.Public()
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, errRSAKeyTooShort
+		}
+		key.Algorithm, key.private, key.public = AlgRS256, k, k.Public()
+	case ed25519.PublicKey:
+		key.Algorithm, key.public = AlgEdDSA, k
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, errRSAKeyTooShort
+		}
+		key.Algorithm, key.public = AlgRS256, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
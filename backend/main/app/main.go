@@ -2,11 +2,18 @@ package main
 
 import (
 	"backend/core/db"
+	"backend/core/mailer"
+	"backend/core/oidc"
+	"backend/core/passwords"
 	"backend/core/routes"
+	"backend/core/services"
+	"backend/core/storage"
+	"backend/core/tokens"
 	"backend/main/config"
 	"fmt"
 	"log"
 	"time"
+	_ "time/tzdata" // time zones of user profiles are validated without relying on the host
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
@@ -14,12 +21,27 @@ import (
 
 func main() {
 	config.LoadConfig()
-	app := fiber.New()
+	mailer.InitMailer()
+	tokens.InitKeyring()
+	passwords.InitPolicy()
+	passwords.InitHasher()
+	oidc.InitProviders()
+	storage.InitStorage()
+	app := fiber.New(fiber.Config{
+		// multipart avatar uploads carry some overhead on top of the file
+		BodyLimit: max(4<<20, config.AVATAR_MAX_BYTES+1<<20),
+		// c.IP() reads the proxy header only for requests coming from a trusted proxy,
+		// login throttling and sessions depend on it
+		ProxyHeader:        config.PROXY_HEADER,
+		TrustProxy:         true,
+		TrustProxyConfig:   fiber.TrustProxyConfig{Proxies: config.TRUSTED_PROXIES},
+		EnableIPValidation: true,
+	})
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001", "http://localhost:80", "https://localhost:443"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Auth-Mode", "X-CSRF-Token"},
 		AllowCredentials: true,
 	}))
 
@@ -35,10 +57,19 @@ func main() {
 	})
 
 	db.InitDB()
+	services.InitLoginGuard()
+	services.InitTokenJanitor()
+	services.InitAccessTokenDenylist()
+	if err := services.LoadPermissions(); err != nil {
+		log.Printf("Failed to load role permissions: %v", err)
+	}
 
 	routes.SetupAuthRoutes(app)
 	routes.SetupUsersRoutes(app)
 	routes.SetupRequestsRoutes(app)
+	routes.SetupAdminRoutes(app)
+	routes.SetupMediaRoutes(app)
+	routes.SetupWellKnownRoutes(app)
 
 	log.Fatal(app.Listen(fmt.Sprintf(":%v", config.PORT)))
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,8 +17,81 @@ var (
 	Database_Name string
 	PORT          string
 	IsInDocker    bool = false
+
+	JWT_KEYS_DIR   string // directory with PEM keys used to sign access tokens
+	JWT_ACTIVE_KID string // kid of the key new tokens are signed with
+	JWT_DEV_KEY    bool   // allows a temporary signing key when JWT_KEYS_DIR is empty, for local development only
+	JWT_ISSUER     string // iss claim of issued tokens
+	JWT_AUDIENCE   string // aud claim of access tokens
+
+	ACCESS_TOKEN_TTL  time.Duration
+	REFRESH_TOKEN_TTL time.Duration
+
+	AUTH_COOKIE_DOMAIN   string // domain of the refresh and CSRF cookies, the API host if empty
+	AUTH_COOKIE_SECURE   bool
+	AUTH_COOKIE_SAMESITE string // "strict", "lax" or "none"
+
+	APP_URL       string // frontend url used to build links in emails
+	API_URL       string // public url of this API, used for links to stored files
+	MAILER        string // "smtp" or "log"
+	MAIL_FROM     string
+	MAIL_LOG_PATH string // file used by the log mailer, stdout if empty
+	SMTP_HOST     string
+	SMTP_PORT     string
+	SMTP_USERNAME string
+	SMTP_PASSWORD string
+
+	LOGIN_TRACKER          string // "postgres" or "memory"
+	LOGIN_MAX_FAILURES     int    // failed logins per account before a lockout
+	LOGIN_IP_MAX_FAILURES  int    // failed logins per ip before a lockout
+	LOGIN_LOCKOUT_DURATION time.Duration
+
+	PROXY_HEADER    string   // header with the client ip set by a reverse proxy, e.g. X-Real-IP
+	TRUSTED_PROXIES []string // ips or CIDR ranges of proxies allowed to set PROXY_HEADER
+
+	TOKEN_JANITOR_INTERVAL time.Duration // how often stale token rows are purged, 0 disables it
+
+	PASSWORD_MIN_LENGTH     int
+	PASSWORD_MAX_LENGTH     int
+	PASSWORD_REQUIRE_LOWER  bool
+	PASSWORD_REQUIRE_UPPER  bool
+	PASSWORD_REQUIRE_DIGIT  bool
+	PASSWORD_REQUIRE_SYMBOL bool
+	PASSWORD_MIN_STRENGTH   int    // 0 to 4
+	PASSWORD_BREACHED_LIST  string // sorted SHA-1 list file, the check is disabled if empty
+
+	PASSWORD_HASH_ALGORITHM string // "argon2id" or "bcrypt", older hashes are upgraded on login
+	PASSWORD_BCRYPT_COST    int
+	PASSWORD_ARGON2_MEMORY  int // KiB
+	PASSWORD_ARGON2_TIME    int
+	PASSWORD_ARGON2_THREADS int
+
+	STORAGE           string // "local" or "s3"
+	STORAGE_LOCAL_DIR string
+	S3_ENDPOINT       string
+	S3_REGION         string
+	S3_BUCKET         string
+	S3_ACCESS_KEY     string
+	S3_SECRET_KEY     string
+	MEDIA_URL_TTL     time.Duration // minimal lifetime of signed file URLs
+	AVATAR_MAX_BYTES  int
+
+	MAX_NATIVE_LANGUAGES int // per user
+	MAX_TARGET_LANGUAGES int
+
+	OIDCProviders []OIDCProvider // from OIDC_PROVIDERS, e.g. "google,apple"
 )
 
+// settings of a social login provider, read from OIDC_<NAME>_* variables
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
 // function to set environment variables
 func LoadConfig() {
 	if err := godotenv.Load("../../.env"); err != nil {
@@ -50,8 +126,162 @@ func LoadConfig() {
 		log.Fatal("Database_Port not setted in the environment")
 	}
 
+	JWT_KEYS_DIR = os.Getenv("JWT_KEYS_DIR")
+	JWT_ACTIVE_KID = os.Getenv("JWT_ACTIVE_KID")
+	JWT_DEV_KEY = getBoolEnvOrDefault("JWT_DEV_KEY", false)
+	JWT_ISSUER = getEnvOrDefault("JWT_ISSUER", "language-exchange")
+	JWT_AUDIENCE = getEnvOrDefault("JWT_AUDIENCE", "language-exchange-api")
+
+	ACCESS_TOKEN_TTL = getDurationEnvOrDefault("ACCESS_TOKEN_TTL", 10*time.Minute)
+	REFRESH_TOKEN_TTL = getDurationEnvOrDefault("REFRESH_TOKEN_TTL", 24*time.Hour)
+
+	AUTH_COOKIE_DOMAIN = os.Getenv("AUTH_COOKIE_DOMAIN")
+	AUTH_COOKIE_SECURE = getBoolEnvOrDefault("AUTH_COOKIE_SECURE", true)
+	AUTH_COOKIE_SAMESITE = strings.ToLower(getEnvOrDefault("AUTH_COOKIE_SAMESITE", "strict"))
+
+	APP_URL = getEnvOrDefault("APP_URL", "http://localhost:3000")
+	API_URL = strings.TrimSuffix(getEnvOrDefault("API_URL", "http://localhost:"+PORT), "/")
+	MAILER = getEnvOrDefault("MAILER", "log")
+	MAIL_FROM = getEnvOrDefault("MAIL_FROM", "no-reply@localhost")
+	MAIL_LOG_PATH = os.Getenv("MAIL_LOG_PATH")
+	SMTP_HOST = os.Getenv("SMTP_HOST")
+	SMTP_PORT = getEnvOrDefault("SMTP_PORT", "587")
+	SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+
+	LOGIN_TRACKER = getEnvOrDefault("LOGIN_TRACKER", "postgres")
+	LOGIN_MAX_FAILURES = getIntEnvOrDefault("LOGIN_MAX_FAILURES", 5)
+	LOGIN_IP_MAX_FAILURES = getIntEnvOrDefault("LOGIN_IP_MAX_FAILURES", 20)
+	LOGIN_LOCKOUT_DURATION = getDurationEnvOrDefault("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+
+	PROXY_HEADER = os.Getenv("PROXY_HEADER")
+	TRUSTED_PROXIES = strings.FieldsFunc(os.Getenv("TRUSTED_PROXIES"), func(r rune) bool { return r == ',' || r == ' ' })
+	if PROXY_HEADER != "" && len(TRUSTED_PROXIES) == 0 {
+		log.Fatal("TRUSTED_PROXIES must be setted when PROXY_HEADER is used")
+	}
+
+	TOKEN_JANITOR_INTERVAL = getDurationEnvOrDefault("TOKEN_JANITOR_INTERVAL", time.Hour)
+
+	PASSWORD_MIN_LENGTH = getIntEnvOrDefault("PASSWORD_MIN_LENGTH", 8)
+	PASSWORD_MAX_LENGTH = getIntEnvOrDefault("PASSWORD_MAX_LENGTH", 72)
+	PASSWORD_REQUIRE_LOWER = getBoolEnvOrDefault("PASSWORD_REQUIRE_LOWER", false)
+	PASSWORD_REQUIRE_UPPER = getBoolEnvOrDefault("PASSWORD_REQUIRE_UPPER", false)
+	PASSWORD_REQUIRE_DIGIT = getBoolEnvOrDefault("PASSWORD_REQUIRE_DIGIT", false)
+	PASSWORD_REQUIRE_SYMBOL = getBoolEnvOrDefault("PASSWORD_REQUIRE_SYMBOL", false)
+	PASSWORD_MIN_STRENGTH = getIntEnvOrDefault("PASSWORD_MIN_STRENGTH", 2)
+	PASSWORD_BREACHED_LIST = os.Getenv("PASSWORD_BREACHED_LIST")
+
+	PASSWORD_HASH_ALGORITHM = getEnvOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id")
+	PASSWORD_BCRYPT_COST = getIntEnvOrDefault("PASSWORD_BCRYPT_COST", 10)
+	PASSWORD_ARGON2_MEMORY = getIntEnvOrDefault("PASSWORD_ARGON2_MEMORY", 19456)
+	PASSWORD_ARGON2_TIME = getIntEnvOrDefault("PASSWORD_ARGON2_TIME", 2)
+	PASSWORD_ARGON2_THREADS = getIntEnvOrDefault("PASSWORD_ARGON2_THREADS", 1)
+
+	STORAGE = getEnvOrDefault("STORAGE", "local")
+	STORAGE_LOCAL_DIR = getEnvOrDefault("STORAGE_LOCAL_DIR", "uploads")
+	S3_ENDPOINT = os.Getenv("S3_ENDPOINT")
+	S3_REGION = getEnvOrDefault("S3_REGION", "us-east-1")
+	S3_BUCKET = os.Getenv("S3_BUCKET")
+	S3_ACCESS_KEY = os.Getenv("S3_ACCESS_KEY")
+	S3_SECRET_KEY = os.Getenv("S3_SECRET_KEY")
+	MEDIA_URL_TTL = getDurationEnvOrDefault("MEDIA_URL_TTL", time.Hour)
+	AVATAR_MAX_BYTES = getIntEnvOrDefault("AVATAR_MAX_BYTES", 5<<20)
+
+	MAX_NATIVE_LANGUAGES = getIntEnvOrDefault("MAX_NATIVE_LANGUAGES", 3)
+	MAX_TARGET_LANGUAGES = getIntEnvOrDefault("MAX_TARGET_LANGUAGES", 5)
+
+	OIDCProviders = loadOIDCProviders()
+
+	if ACCESS_TOKEN_TTL <= 0 || REFRESH_TOKEN_TTL <= 0 {
+		log.Fatal("ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL must be positive")
+	}
+	if AUTH_COOKIE_SAMESITE != "strict" && AUTH_COOKIE_SAMESITE != "lax" && AUTH_COOKIE_SAMESITE != "none" {
+		log.Fatal("AUTH_COOKIE_SAMESITE must be strict, lax or none")
+	}
+	if STORAGE == "s3" && (S3_ENDPOINT == "" || S3_BUCKET == "" || S3_ACCESS_KEY == "" || S3_SECRET_KEY == "") {
+		log.Fatal("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY must be setted for s3 storage")
+	}
+	if MEDIA_URL_TTL <= 0 {
+		log.Fatal("MEDIA_URL_TTL must be positive")
+	}
+	if MAILER == "smtp" && SMTP_HOST == "" {
+		log.Fatal("SMTP_HOST not setted in the environment")
+	}
+
 	Database_Url = fmt.Sprintf(
 		"postgresql://%v:%v@%v:%v/%v?sslmode=disable",
 		Database_User, Database_Password, Database_Host, Database_Port, Database_Name,
 	)
 }
+
+func getEnvOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getIntEnvOrDefault(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer", key)
+	}
+	return parsed
+}
+
+func getBoolEnvOrDefault(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s must be true or false", key)
+	}
+	return parsed
+}
+
+// durations use the time.ParseDuration format, e.g. "15m"
+func getDurationEnvOrDefault(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration like 15m", key)
+	}
+	return parsed
+}
+
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(getEnvOrDefault(prefix+"SCOPES", "openid email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			log.Fatalf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL must be setted", prefix, prefix, prefix)
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers
+}